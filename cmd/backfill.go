@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/neptship/wbtech-orders/internal/config"
+	"github.com/neptship/wbtech-orders/internal/repository"
+	"github.com/neptship/wbtech-orders/internal/service"
+)
+
+// runBackfill implements "backfill", which copies orders stored before the
+// normalized layout was enabled into its tables.
+func runBackfill(ctx context.Context, cfg config.Config, args []string) error {
+	fs := flag.NewFlagSet("backfill", flag.ContinueOnError)
+	batch := fs.Int("batch", 500, "orders per transaction")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *batch < 1 {
+		return fmt.Errorf("-batch must be positive")
+	}
+	db, err := service.OpenDB(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	stats, err := repository.BackfillNormalized(ctx, db, *batch)
+	fmt.Printf("migrated %d orders, %d failed\n", stats.Migrated, stats.Failed)
+	return err
+}
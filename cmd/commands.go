@@ -0,0 +1,23 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/neptship/wbtech-orders/internal/config"
+)
+
+// runCommand runs the maintenance command named by args[0] instead of the
+// service.
+func runCommand(ctx context.Context, cfg config.Config, args []string) error {
+	switch args[0] {
+	case "dlq":
+		return runDLQ(ctx, cfg, args[1:])
+	case "backfill":
+		return runBackfill(ctx, cfg, args[1:])
+	case "migrate":
+		return runMigrate(ctx, cfg, args[1:])
+	default:
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/neptship/wbtech-orders/internal/config"
+	"github.com/neptship/wbtech-orders/internal/kafka"
+	"github.com/neptship/wbtech-orders/internal/service"
+)
+
+// runDLQ implements "dlq list" and "dlq redrive".
+func runDLQ(ctx context.Context, cfg config.Config, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: dlq list|redrive [-limit N]")
+	}
+	fs := flag.NewFlagSet("dlq "+args[0], flag.ContinueOnError)
+	limit := fs.Int("limit", 100, "maximum number of messages")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	switch args[0] {
+	case "list":
+		msgs, err := service.NewDeadLetters(cfg, nil).List(ctx, *limit)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(msgs)
+	case "redrive":
+		producer, err := kafka.NewProducer(kafka.ProducerConfig{Brokers: cfg.Kafka.Brokers, Topic: cfg.Kafka.Topic})
+		if err != nil {
+			return err
+		}
+		defer producer.Close()
+		n, err := service.NewDeadLetters(cfg, producer).Redrive(ctx, *limit)
+		fmt.Printf("redriven %d messages\n", n)
+		return err
+	default:
+		return fmt.Errorf("unknown dlq command %q", args[0])
+	}
+}
@@ -3,7 +3,7 @@ package main
 import (
 	"context"
 	"errors"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
@@ -12,42 +12,103 @@ import (
 
 	"github.com/neptship/wbtech-orders/internal/api"
 	"github.com/neptship/wbtech-orders/internal/config"
+	"github.com/neptship/wbtech-orders/internal/logging"
+	"github.com/neptship/wbtech-orders/internal/metrics"
 	"github.com/neptship/wbtech-orders/internal/service"
+	"github.com/neptship/wbtech-orders/internal/tracing"
+	"github.com/neptship/wbtech-orders/web"
 )
 
 func main() {
 	cfg := config.Load()
+	logging.Setup(os.Stderr, cfg.Log.Level)
+	for _, w := range cfg.Warnings() {
+		slog.Warn("config: " + w)
+	}
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
-	svc, err := service.New(ctx, cfg)
+	if len(os.Args) > 1 {
+		if err := runCommand(ctx, cfg, os.Args[1:]); err != nil {
+			fatal("command failed", err)
+		}
+		return
+	}
+
+	shutdownTracing, err := tracing.Setup(tracing.Config{
+		ServiceName: "wbtech-orders",
+		Exporter:    cfg.Tracing.Exporter,
+		File:        cfg.Tracing.File,
+		SampleRatio: cfg.Tracing.SampleRatio,
+	})
 	if err != nil {
-		log.Fatalf("init service: %v", err)
+		slog.Error("tracing disabled", "err", err)
+		shutdownTracing = func(context.Context) error { return nil }
 	}
-	svc.StartConsumer(ctx)
 
+	svc, err := service.New(ctx, cfg)
+	if err != nil {
+		fatal("init service", err)
+	}
 	h := api.NewHandler(svc, cfg)
-	http.HandleFunc("/order_add", h.OrderAddHandler())
-	http.HandleFunc("/order/", h.OrderGetHandler())
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) })
+	routes := map[string]http.Handler{
+		"/order_add":          h.OrderAddHandler(),
+		"/order/":             h.OrderGetHandler(),
+		"/order/{uid}/status": h.OrderStatusHandler(),
+		"/orders":             h.OrderListHandler(),
+		"/orders/by-track/":   h.OrdersByTrackHandler(),
+		"/orders/by-rid/":     h.OrderByRIDHandler(),
+		"/orders/by-chrt/":    h.OrdersByChrtHandler(),
+		"/dlq":                h.DLQListHandler(),
+		"/dlq/redrive":        h.DLQRedriveHandler(),
+		"/healthz":            h.HealthzHandler(),
+		"/readyz":             h.ReadyzHandler(),
+	}
+	for pattern, handler := range routes {
+		http.HandleFunc(pattern, api.Instrument(pattern, handler))
+	}
+	http.Handle("/metrics", metrics.Handler())
+	http.Handle("/", web.Handler())
 
-	srv := &http.Server{Addr: ":" + cfg.HTTP.Port, Handler: nil}
+	srv := &http.Server{Addr: ":" + cfg.HTTP.Port, Handler: api.RequestID(api.AccessLog(http.DefaultServeMux))}
 
 	go func() {
-		log.Printf("HTTP server on :%s", cfg.HTTP.Port)
+		slog.Info("http server listening", "addr", srv.Addr)
 		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			log.Fatalf("listen: %v", err)
+			fatal("listen", err)
 		}
 	}()
 
+	if err := svc.Warmup(ctx, cfg.Cache.WarmupSize); err != nil {
+		slog.Error("cache warmup failed", "err", err)
+	}
+	svc.StartConsumer(ctx)
+	if cfg.Outbox.Enabled {
+		svc.StartOutboxRelay(ctx)
+	}
+
 	<-ctx.Done()
-	log.Println("shutdown signal received")
+	slog.Info("shutdown signal received")
+	svc.BeginShutdown()
+	if cfg.HTTP.ShutdownDelay > 0 {
+		slog.Info("draining before closing listeners", "delay", cfg.HTTP.ShutdownDelay.String())
+		time.Sleep(cfg.HTTP.ShutdownDelay)
+	}
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	if err := srv.Shutdown(shutdownCtx); err != nil {
-		log.Printf("server shutdown error: %v", err)
+		slog.Error("http server shutdown failed", "err", err)
 	}
 	_ = svc.Producer.Close()
+	_ = svc.DLQ.Close()
 	_ = svc.DB.Close()
-	log.Println("graceful shutdown complete")
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Error("flush traces failed", "err", err)
+	}
+	slog.Info("graceful shutdown complete")
+}
+
+func fatal(msg string, err error) {
+	slog.Error(msg, "err", err)
+	os.Exit(1)
 }
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/neptship/wbtech-orders/internal/config"
+	"github.com/neptship/wbtech-orders/internal/migrate"
+	"github.com/neptship/wbtech-orders/internal/service"
+	"github.com/neptship/wbtech-orders/migrations"
+)
+
+// runMigrate implements "migrate up", "migrate down" and "migrate status"
+// with the migrations embedded in the binary.
+func runMigrate(ctx context.Context, cfg config.Config, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: migrate up|down|status")
+	}
+	db, err := service.OpenDB(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	m, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		return err
+	}
+	switch args[0] {
+	case "up":
+		applied, err := m.Up(ctx)
+		fmt.Printf("applied %d migrations\n", len(applied))
+		return err
+	case "down":
+		mig, ok, err := m.Down(ctx)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Println("no migrations to roll back")
+			return nil
+		}
+		fmt.Printf("rolled back %s\n", mig.Name)
+		return nil
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "APPLIED AT\tMIGRATION")
+		for _, s := range statuses {
+			at := "pending"
+			if s.Applied() {
+				at = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%s\t%s\n", at, s.Migration.Name)
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("unknown migrate command %q", args[0])
+	}
+}
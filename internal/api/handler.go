@@ -1,56 +1,124 @@
 package api
 
 import (
+	"crypto/subtle"
 	"encoding/json"
-	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/neptship/wbtech-orders/internal/config"
+	"github.com/neptship/wbtech-orders/internal/health"
+	"github.com/neptship/wbtech-orders/internal/models"
 	"github.com/neptship/wbtech-orders/internal/repository"
 	"github.com/neptship/wbtech-orders/internal/service"
 	"github.com/neptship/wbtech-orders/internal/validation"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = otel.Tracer("github.com/neptship/wbtech-orders/internal/api")
+
 type Handler struct {
 	svc   *service.Service
 	cfg   config.Config
+	rules validation.Rules
 	limit int64
 }
 
 func NewHandler(svc *service.Service, cfg config.Config) *Handler {
-	return &Handler{svc: svc, cfg: cfg, limit: 1 << 20}
+	return &Handler{svc: svc, cfg: cfg, rules: validation.NewRules(cfg.Validation.Rules), limit: 1 << 20}
 }
 
-func (h *Handler) OrderAddHandler() http.HandlerFunc { return h.handleOrderAdd }
-func (h *Handler) OrderGetHandler() http.HandlerFunc { return h.handleOrderGet }
+func (h *Handler) OrderAddHandler() http.HandlerFunc      { return h.handleOrderAdd }
+func (h *Handler) OrderGetHandler() http.HandlerFunc      { return h.handleOrderGet }
+func (h *Handler) OrderStatusHandler() http.HandlerFunc   { return h.handleOrderStatus }
+func (h *Handler) OrderListHandler() http.HandlerFunc     { return h.handleOrderList }
+func (h *Handler) OrdersByTrackHandler() http.HandlerFunc { return h.handleOrdersByTrack }
+func (h *Handler) OrderByRIDHandler() http.HandlerFunc    { return h.handleOrderByRID }
+func (h *Handler) OrdersByChrtHandler() http.HandlerFunc  { return h.handleOrdersByChrt }
+func (h *Handler) DLQListHandler() http.HandlerFunc       { return h.admin(h.handleDLQList) }
+func (h *Handler) DLQRedriveHandler() http.HandlerFunc    { return h.admin(h.handleDLQRedrive) }
+func (h *Handler) HealthzHandler() http.HandlerFunc       { return h.handleHealthz }
+func (h *Handler) ReadyzHandler() http.HandlerFunc        { return h.handleReadyz }
 
 func (h *Handler) handleOrderAdd(w http.ResponseWriter, r *http.Request) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := tracer.Start(ctx, "POST /order_add", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+	r = r.WithContext(ctx)
+
 	if r.Method != http.MethodPost {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, r, methodNotAllowed(http.MethodPost))
 		return
 	}
 	defer r.Body.Close()
 	raw, err := io.ReadAll(io.LimitReader(r.Body, h.limit))
 	if err != nil {
-		http.Error(w, "read error", http.StatusBadRequest)
+		writeError(w, r, badRequest(CodeBadRequest, "cannot read request body"))
 		return
 	}
-	var meta struct {
-		OrderUID    string `json:"order_uid"`
-		TrackNumber string `json:"track_number"`
+	if key := r.Header.Get("Idempotency-Key"); key != "" && h.svc.Idempotency != nil {
+		h.idempotent(w, r, key, raw, func(w http.ResponseWriter) { h.addOrder(w, r, raw) })
+		return
 	}
-	if err := json.Unmarshal(raw, &meta); err != nil || meta.OrderUID == "" {
-		http.Error(w, "invalid json: order_uid required", http.StatusBadRequest)
+	h.addOrder(w, r, raw)
+}
+
+func (h *Handler) addOrder(w http.ResponseWriter, r *http.Request, raw []byte) {
+	span := trace.SpanFromContext(r.Context())
+	var order models.Order
+	if err := json.Unmarshal(raw, &order); err != nil {
+		writeError(w, r, badRequest(CodeInvalidJSON, err.Error()))
 		return
 	}
-	if err := validation.Basic(meta.OrderUID, meta.TrackNumber); err != nil {
-		http.Error(w, "validation failed: "+err.Error(), http.StatusBadRequest)
+	span.SetAttributes(attribute.String("order.uid", order.OrderUID))
+	errs, warnings := validation.Check(order, h.rules)
+	if len(errs) > 0 {
+		p := problemFor(errs)
+		p.Warnings = warnings
+		writeProblem(w, r, p)
 		return
 	}
-	if err := h.svc.PublishRawOrder(r.Context(), raw); err != nil {
-		http.Error(w, "kafka error", http.StatusBadGateway)
+	wait, err := parseWait(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var outcomes <-chan service.Outcome
+	if wait > 0 {
+		ch, cancel := h.svc.AwaitOutcome(order.OrderUID)
+		defer cancel()
+		outcomes = ch
+	}
+	if err := h.svc.PublishOrder(r.Context(), order.OrderUID, raw); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case out := <-outcomes:
+			if out.Saved() {
+				writeJSON(w, http.StatusCreated, out.Order)
+			} else {
+				writeError(w, r, &rejectedError{reason: out.Reason, err: out.Err})
+			}
+			return
+		case <-timer.C:
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if len(warnings) > 0 {
+		writeJSON(w, http.StatusAccepted, map[string]any{"status": "queued", "warnings": warnings})
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -58,27 +126,256 @@ func (h *Handler) handleOrderAdd(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write([]byte(`{"status":"queued"}`))
 }
 
+// maxWait caps how long a synchronous /order_add may hold the connection.
+const maxWait = 30 * time.Second
+
+// parseWait reads the synchronous mode timeout from ?wait=5s or an RFC 7240
+// "Prefer: wait=5" header; zero means asynchronous.
+func parseWait(r *http.Request) (time.Duration, error) {
+	if v := r.URL.Query().Get("wait"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 || d > maxWait {
+			return 0, badRequest(CodeInvalidParameter, fmt.Sprintf("wait must be a duration between 0 and %s", maxWait))
+		}
+		return d, nil
+	}
+	for _, pref := range strings.Split(r.Header.Get("Prefer"), ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(pref), "=")
+		if !ok || !strings.EqualFold(k, "wait") {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil || n <= 0 {
+			return 0, badRequest(CodeInvalidParameter, "Prefer wait must be a positive number of seconds")
+		}
+		return min(time.Duration(n)*time.Second, maxWait), nil
+	}
+	return 0, nil
+}
+
 func (h *Handler) handleOrderGet(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, r, methodNotAllowed(http.MethodGet))
 		return
 	}
 	orderUID := strings.TrimPrefix(r.URL.Path, "/order/")
 	if orderUID == "" {
-		http.Error(w, "order_uid required", 400)
+		writeError(w, r, badRequest(CodeInvalidParameter, "order_uid required"))
 		return
 	}
 	o, err := h.svc.GetOrder(r.Context(), orderUID)
 	if err != nil {
-		if errors.Is(err, repository.ErrNotFound) {
-			http.Error(w, "not found", http.StatusNotFound)
-		} else {
-			http.Error(w, "internal error", http.StatusInternalServerError)
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, o)
+}
+
+// handleOrderStatus serves /order/{uid}/status.
+func (h *Handler) handleOrderStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, r, methodNotAllowed(http.MethodGet))
+		return
+	}
+	st, err := h.svc.IngestionStatus(r.Context(), r.PathValue("uid"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, st)
+}
+
+func (h *Handler) handleOrderList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, r, methodNotAllowed(http.MethodGet))
+		return
+	}
+	f, err := parseOrderFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	page, err := h.svc.ListOrders(r.Context(), f)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+func parseOrderFilter(q url.Values) (repository.OrderFilter, error) {
+	f := repository.OrderFilter{
+		CustomerID:      q.Get("customer_id"),
+		TrackNumber:     q.Get("track_number"),
+		DeliveryService: q.Get("delivery_service"),
+		Currency:        q.Get("currency"),
+		Provider:        q.Get("provider"),
+		Brand:           q.Get("brand"),
+		Cursor:          q.Get("cursor"),
+	}
+	var err error
+	if v := q.Get("created_from"); v != "" {
+		if f.CreatedFrom, err = time.Parse(time.RFC3339, v); err != nil {
+			return f, badRequest(CodeInvalidParameter, "created_from must be an RFC 3339 timestamp")
 		}
+	}
+	if v := q.Get("created_to"); v != "" {
+		if f.CreatedTo, err = time.Parse(time.RFC3339, v); err != nil {
+			return f, badRequest(CodeInvalidParameter, "created_to must be an RFC 3339 timestamp")
+		}
+	}
+	if v := q.Get("nm_id"); v != "" {
+		if f.NmID, err = strconv.Atoi(v); err != nil {
+			return f, badRequest(CodeInvalidParameter, "nm_id must be an integer")
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		if f.Limit, err = strconv.Atoi(v); err != nil || f.Limit < 1 || f.Limit > repository.MaxPageSize {
+			return f, badRequest(CodeInvalidParameter, fmt.Sprintf("limit must be between 1 and %d", repository.MaxPageSize))
+		}
+	}
+	return f, nil
+}
+
+func (h *Handler) handleOrdersByTrack(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, r, methodNotAllowed(http.MethodGet))
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(o); err != nil {
-		http.Error(w, "encode error", http.StatusInternalServerError)
+	track := strings.TrimPrefix(r.URL.Path, "/orders/by-track/")
+	if track == "" {
+		writeError(w, r, badRequest(CodeInvalidParameter, "track number required"))
+		return
+	}
+	orders, err := h.svc.OrdersByTrack(r.Context(), track)
+	writeOrders(w, r, orders, err)
+}
+
+func (h *Handler) handleOrderByRID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, r, methodNotAllowed(http.MethodGet))
+		return
+	}
+	rid := strings.TrimPrefix(r.URL.Path, "/orders/by-rid/")
+	if rid == "" {
+		writeError(w, r, badRequest(CodeInvalidParameter, "rid required"))
+		return
+	}
+	o, err := h.svc.OrderByRID(r.Context(), rid)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, o)
+}
+
+func (h *Handler) handleOrdersByChrt(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, r, methodNotAllowed(http.MethodGet))
+		return
+	}
+	chrtID, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/orders/by-chrt/"))
+	if err != nil || chrtID <= 0 {
+		writeError(w, r, badRequest(CodeInvalidParameter, "chrt_id must be a positive integer"))
+		return
+	}
+	orders, err := h.svc.OrdersByChrtID(r.Context(), chrtID)
+	writeOrders(w, r, orders, err)
+}
+
+func writeOrders(w http.ResponseWriter, r *http.Request, orders []models.Order, err error) {
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if len(orders) == 0 {
+		writeError(w, r, notFound("no matching orders"))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"orders": orders})
+}
+
+// admin guards next with the HTTP.AdminToken bearer token. Without a
+// configured token the endpoint is disabled.
+func (h *Handler) admin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := h.cfg.HTTP.AdminToken
+		if token == "" {
+			writeError(w, r, forbidden("admin endpoints are disabled, set HTTP_ADMIN_TOKEN to enable them"))
+			return
+		}
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			writeError(w, r, unauthorized("a valid admin bearer token is required"))
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (h *Handler) handleDLQList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, r, methodNotAllowed(http.MethodGet))
+		return
+	}
+	limit, err := parseLimit(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	msgs, err := h.svc.DeadLetters.List(r.Context(), limit)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"messages": msgs})
+}
+
+func (h *Handler) handleDLQRedrive(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, r, methodNotAllowed(http.MethodPost))
+		return
+	}
+	limit, err := parseLimit(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
+	n, err := h.svc.DeadLetters.Redrive(r.Context(), limit)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"redriven": n})
+}
+
+func (h *Handler) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, health.Report{Status: health.StatusOK, Checks: map[string]health.Result{}})
+}
+
+func (h *Handler) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	rep := h.svc.Readiness(r.Context(), 2*time.Second)
+	status := http.StatusOK
+	if !rep.OK() {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, rep)
+}
+
+func parseLimit(r *http.Request) (int, error) {
+	v := r.URL.Query().Get("limit")
+	if v == "" {
+		return 100, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 || n > 1000 {
+		return 0, badRequest(CodeInvalidParameter, "limit must be between 1 and 1000")
+	}
+	return n, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
 }
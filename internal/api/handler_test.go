@@ -0,0 +1,162 @@
+package api_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neptship/wbtech-orders/internal/api"
+	"github.com/neptship/wbtech-orders/internal/cache"
+	"github.com/neptship/wbtech-orders/internal/config"
+	"github.com/neptship/wbtech-orders/internal/models"
+	"github.com/neptship/wbtech-orders/internal/repository"
+	"github.com/neptship/wbtech-orders/internal/service"
+	"github.com/neptship/wbtech-orders/mocks"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func decodeProblem(t *testing.T, rec *httptest.ResponseRecorder) api.Problem {
+	t.Helper()
+	require.Equal(t, "application/problem+json", rec.Header().Get("Content-Type"))
+	var p api.Problem
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&p))
+	require.Equal(t, rec.Code, p.Status)
+	return p
+}
+
+func TestHandler_OrderNotFoundIsProblem(t *testing.T) {
+	repo := mocks.NewOrderRepositoryMock(t)
+	h := api.NewHandler(&service.Service{Cache: cache.NewCache(10, 0), Repo: repo}, config.Config{})
+	repo.EXPECT().Get(mock.Anything, "missing").Return(models.Order{}, repository.ErrNotFound)
+
+	req := httptest.NewRequest(http.MethodGet, "/order/missing", nil)
+	req.Header.Set("X-Request-ID", "req-42")
+	rec := httptest.NewRecorder()
+	h.OrderGetHandler().ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	p := decodeProblem(t, rec)
+	require.Equal(t, api.CodeNotFound, p.Code)
+	require.Equal(t, "req-42", p.RequestID)
+	require.Equal(t, "/order/missing", p.Instance)
+	require.Equal(t, "req-42", rec.Header().Get("X-Request-ID"))
+}
+
+func TestHandler_OrderAddValidationProblem(t *testing.T) {
+	h := api.NewHandler(&service.Service{}, config.Config{})
+
+	rec := httptest.NewRecorder()
+	h.OrderAddHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/order_add", strings.NewReader(`{"order_uid":"x"}`)))
+
+	require.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	p := decodeProblem(t, rec)
+	require.Equal(t, api.CodeValidationFailed, p.Code)
+	require.NotEmpty(t, p.Errors)
+	require.NotEmpty(t, p.RequestID)
+}
+
+func TestHandler_BadInputProblems(t *testing.T) {
+	h := api.NewHandler(&service.Service{}, config.Config{})
+	cases := []struct {
+		name    string
+		handler http.Handler
+		req     *http.Request
+		status  int
+		code    string
+	}{
+		{"invalid json", h.OrderAddHandler(), httptest.NewRequest(http.MethodPost, "/order_add", strings.NewReader(`{`)), http.StatusBadRequest, api.CodeInvalidJSON},
+		{"bad filter", h.OrderListHandler(), httptest.NewRequest(http.MethodGet, "/orders?nm_id=abc", nil), http.StatusBadRequest, api.CodeInvalidParameter},
+		{"wrong method", h.OrderAddHandler(), httptest.NewRequest(http.MethodGet, "/order_add", nil), http.StatusMethodNotAllowed, api.CodeMethodNotAllowed},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tc.handler.ServeHTTP(rec, tc.req)
+			require.Equal(t, tc.status, rec.Code)
+			require.Equal(t, tc.code, decodeProblem(t, rec).Code)
+		})
+	}
+}
+
+func TestHandler_OrderAddIdempotencyKey(t *testing.T) {
+	store := mocks.NewIdempotencyRepositoryMock(t)
+	cfg := config.Config{HTTP: config.HTTPConfig{IdempotencyTTL: time.Hour}}
+	h := api.NewHandler(&service.Service{Idempotency: store}, cfg)
+	body := `{"order_uid":"x"}`
+	sum := sha256.Sum256([]byte(body))
+	hash := hex.EncodeToString(sum[:])
+	post := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/order_add", strings.NewReader(body))
+		req.Header.Set("Idempotency-Key", key)
+		rec := httptest.NewRecorder()
+		h.OrderAddHandler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	store.EXPECT().Claim(mock.Anything, "first", hash, time.Minute).Return(repository.IdempotencyRecord{}, true, nil).Once()
+	store.EXPECT().Complete(mock.Anything, "first", mock.MatchedBy(func(rec repository.IdempotencyRecord) bool {
+		return rec.StatusCode == http.StatusUnprocessableEntity &&
+			rec.Header.Get("Content-Type") == "application/problem+json" && rec.Header.Get("X-Request-ID") == ""
+	}), time.Hour).Return(nil).Once()
+	require.Equal(t, http.StatusUnprocessableEntity, post("first").Code)
+
+	store.EXPECT().Claim(mock.Anything, "replayed", hash, time.Minute).Return(repository.IdempotencyRecord{
+		RequestHash: hash, StatusCode: http.StatusAccepted,
+		Header: http.Header{"Content-Type": {"application/json"}, "Location": {"/order/x/status"}},
+		Body:   []byte(`{"status":"queued"}`),
+	}, false, nil).Once()
+	rec := post("replayed")
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	require.Equal(t, "/order/x/status", rec.Header().Get("Location"))
+	require.Equal(t, "true", rec.Header().Get("Idempotent-Replayed"))
+	require.JSONEq(t, `{"status":"queued"}`, rec.Body.String())
+
+	store.EXPECT().Claim(mock.Anything, "reused", hash, time.Minute).Return(repository.IdempotencyRecord{
+		RequestHash: "other", StatusCode: http.StatusAccepted,
+	}, false, nil).Once()
+	rec = post("reused")
+	require.Equal(t, http.StatusConflict, rec.Code)
+	require.Equal(t, api.CodeIdempotencyReused, decodeProblem(t, rec).Code)
+
+	store.EXPECT().Claim(mock.Anything, "running", hash, time.Minute).Return(repository.IdempotencyRecord{RequestHash: hash}, false, nil).Once()
+	rec = post("running")
+	require.Equal(t, http.StatusConflict, rec.Code)
+	require.Equal(t, api.CodeIdempotencyInUse, decodeProblem(t, rec).Code)
+}
+
+func TestHandler_DLQRequiresAdminToken(t *testing.T) {
+	redrive := func(cfg config.Config, auth string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/dlq/redrive", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		rec := httptest.NewRecorder()
+		api.NewHandler(&service.Service{}, cfg).DLQRedriveHandler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := redrive(config.Config{}, "Bearer anything")
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	require.Equal(t, api.CodeForbidden, decodeProblem(t, rec).Code)
+
+	cfg := config.Config{HTTP: config.HTTPConfig{AdminToken: "s3cret"}}
+	rec = redrive(cfg, "")
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.Equal(t, "Bearer", rec.Header().Get("WWW-Authenticate"))
+	require.Equal(t, api.CodeUnauthorized, decodeProblem(t, rec).Code)
+
+	rec = redrive(cfg, "Bearer wrong")
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/dlq/redrive", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	api.NewHandler(&service.Service{}, cfg).DLQRedriveHandler().ServeHTTP(rec, req)
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
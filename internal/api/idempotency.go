@@ -0,0 +1,100 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/neptship/wbtech-orders/internal/repository"
+)
+
+const maxIdempotencyKeyLen = 255
+
+// idempotencyLease is how long a key stays reserved for a request that has
+// not finished yet; a key left behind by a crashed process frees up after it.
+const idempotencyLease = time.Minute
+
+// replayedHeaders are the response headers stored with an idempotent
+// response and sent again on replay. Per-request headers such as
+// X-Request-ID are not among them.
+var replayedHeaders = []string{"Content-Type", "Content-Language", "Location", "Retry-After", "Allow"}
+
+// bodyRecorder passes a response through while keeping a copy of it.
+type bodyRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *bodyRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *bodyRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// idempotent serves a request carrying an Idempotency-Key. The first request
+// with a key is served by serve and its response stored; a retry with the
+// same body gets that response back, a different body or a retry while the
+// first request is still running gets 409. Server errors are not stored, so
+// the client can retry them under the same key.
+func (h *Handler) idempotent(w http.ResponseWriter, r *http.Request, key string, raw []byte, serve func(http.ResponseWriter)) {
+	if len(key) > maxIdempotencyKeyLen {
+		writeError(w, r, badRequest(CodeInvalidParameter, "Idempotency-Key must be at most 255 characters"))
+		return
+	}
+	sum := sha256.Sum256(raw)
+	hash := hex.EncodeToString(sum[:])
+	store := h.svc.Idempotency
+	rec, claimed, err := store.Claim(r.Context(), key, hash, idempotencyLease)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if !claimed {
+		switch {
+		case rec.RequestHash != hash:
+			writeError(w, r, conflict(CodeIdempotencyReused, "Idempotency-Key was already used with a different request body"))
+		case !rec.Completed():
+			writeError(w, r, conflict(CodeIdempotencyInUse, "a request with this Idempotency-Key is still in progress"))
+		default:
+			for name, values := range rec.Header {
+				w.Header()[name] = values
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(rec.StatusCode)
+			_, _ = w.Write(rec.Body)
+		}
+		return
+	}
+
+	resp := &bodyRecorder{ResponseWriter: w}
+	serve(resp)
+	ctx := context.WithoutCancel(r.Context())
+	if resp.status == 0 || resp.status >= http.StatusInternalServerError {
+		err = store.Release(ctx, key)
+	} else {
+		stored := repository.IdempotencyRecord{StatusCode: resp.status, Header: http.Header{}, Body: resp.body.Bytes()}
+		for _, name := range replayedHeaders {
+			if values := resp.Header().Values(name); len(values) > 0 {
+				stored.Header[name] = values
+			}
+		}
+		err = store.Complete(ctx, key, stored, h.cfg.HTTP.IdempotencyTTL)
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "store idempotent response failed", "idempotency_key", key, "err", err)
+	}
+}
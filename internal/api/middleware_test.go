@@ -0,0 +1,79 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/neptship/wbtech-orders/internal/api"
+	"github.com/neptship/wbtech-orders/internal/logging"
+	"github.com/neptship/wbtech-orders/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstrument_RecordsStatusPerRoute(t *testing.T) {
+	h := api.Instrument("/test-route/", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "not found", http.StatusNotFound)
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/test-route/abc", nil))
+
+	require.NoError(t, testutil.GatherAndCompare(metrics.Registry, strings.NewReader(`
+# HELP http_requests_total HTTP requests by route, method and status code.
+# TYPE http_requests_total counter
+http_requests_total{code="404",method="GET",route="/test-route/"} 1
+`), "http_requests_total"))
+	n, err := testutil.GatherAndCount(metrics.Registry, "http_request_duration_seconds")
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+}
+
+func TestRequestID_PropagatesOrAssigns(t *testing.T) {
+	var seen string
+	h := api.RequestID(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		seen = logging.RequestID(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Request-ID", "abc-123")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	require.Equal(t, "abc-123", seen)
+	require.Equal(t, "abc-123", rec.Header().Get("X-Request-ID"))
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Request-ID", "bad id\n")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	require.NotEqual(t, "bad id\n", seen)
+	require.Len(t, seen, 16)
+	require.Equal(t, seen, rec.Header().Get("X-Request-ID"))
+}
+
+func TestAccessLog_LogsRequest(t *testing.T) {
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(logging.New(&buf, slog.LevelInfo))
+	defer slog.SetDefault(prev)
+
+	h := api.RequestID(api.AccessLog(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("hello"))
+	})))
+	req := httptest.NewRequest(http.MethodPost, "/order_add", nil)
+	req.Header.Set("X-Request-ID", "req-7")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	var rec map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &rec))
+	require.Equal(t, "POST", rec["method"])
+	require.Equal(t, "/order_add", rec["path"])
+	require.Equal(t, float64(http.StatusCreated), rec["status"])
+	require.Equal(t, float64(5), rec["bytes"])
+	require.Equal(t, "req-7", rec["request_id"])
+	require.Contains(t, rec, "duration_ms")
+}
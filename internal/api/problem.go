@@ -0,0 +1,167 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/neptship/wbtech-orders/internal/kafka"
+	"github.com/neptship/wbtech-orders/internal/logging"
+	"github.com/neptship/wbtech-orders/internal/repository"
+	"github.com/neptship/wbtech-orders/internal/validation"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Stable error codes returned in the "code" member of every problem; clients
+// branch on these, so they must never change meaning.
+const (
+	CodeBadRequest        = "bad_request"
+	CodeInvalidJSON       = "invalid_json"
+	CodeInvalidParameter  = "invalid_parameter"
+	CodeInvalidCursor     = "invalid_cursor"
+	CodeValidationFailed  = "validation_failed"
+	CodeOrderRejected     = "order_rejected"
+	CodeUnauthorized      = "unauthorized"
+	CodeForbidden         = "forbidden"
+	CodeNotFound          = "not_found"
+	CodeMethodNotAllowed  = "method_not_allowed"
+	CodeIdempotencyReused = "idempotency_key_reused"
+	CodeIdempotencyInUse  = "idempotency_key_in_use"
+	CodeBrokerUnavailable = "broker_unavailable"
+	CodeInternal          = "internal_error"
+)
+
+// Problem is an RFC 7807 problem details body with the extension members
+// code, request_id and, for validation failures, errors and warnings.
+type Problem struct {
+	Type      string                  `json:"type"`
+	Title     string                  `json:"title"`
+	Status    int                     `json:"status"`
+	Code      string                  `json:"code"`
+	Detail    string                  `json:"detail,omitempty"`
+	Instance  string                  `json:"instance,omitempty"`
+	RequestID string                  `json:"request_id,omitempty"`
+	Reason    string                  `json:"reason,omitempty"`
+	Errors    validation.Errors       `json:"errors,omitempty"`
+	Warnings  []validation.FieldError `json:"warnings,omitempty"`
+}
+
+// apiError is an error raised by the handlers themselves, already carrying
+// its status and code.
+type apiError struct {
+	status int
+	code   string
+	detail string
+	allow  string
+}
+
+func (e *apiError) Error() string { return e.detail }
+
+func badRequest(code, detail string) error {
+	return &apiError{status: http.StatusBadRequest, code: code, detail: detail}
+}
+
+func unauthorized(detail string) error {
+	return &apiError{status: http.StatusUnauthorized, code: CodeUnauthorized, detail: detail}
+}
+
+func forbidden(detail string) error {
+	return &apiError{status: http.StatusForbidden, code: CodeForbidden, detail: detail}
+}
+
+func notFound(detail string) error {
+	return &apiError{status: http.StatusNotFound, code: CodeNotFound, detail: detail}
+}
+
+func conflict(code, detail string) error {
+	return &apiError{status: http.StatusConflict, code: code, detail: detail}
+}
+
+func methodNotAllowed(allow string) error {
+	return &apiError{status: http.StatusMethodNotAllowed, code: CodeMethodNotAllowed, detail: "method not allowed", allow: allow}
+}
+
+// rejectedError is the consumer's verdict on an order awaited synchronously.
+type rejectedError struct {
+	reason string
+	err    error
+}
+
+func (e *rejectedError) Error() string { return e.reason + ": " + e.err.Error() }
+
+// problemFor maps every error the handlers can see to a problem; it is the
+// only place that decides status codes and error codes.
+func problemFor(err error) Problem {
+	var (
+		apiErr   *apiError
+		verrs    validation.Errors
+		rejected *rejectedError
+		brokerE  *kafka.BrokerError
+	)
+	switch {
+	case errors.As(err, &apiErr):
+		return newProblem(apiErr.status, apiErr.code, apiErr.detail)
+	case errors.As(err, &verrs):
+		p := newProblem(http.StatusUnprocessableEntity, CodeValidationFailed, "order failed validation")
+		p.Errors = verrs
+		return p
+	case errors.As(err, &rejected):
+		p := newProblem(http.StatusUnprocessableEntity, CodeOrderRejected, rejected.err.Error())
+		p.Reason = rejected.reason
+		return p
+	case errors.Is(err, repository.ErrNotFound):
+		return newProblem(http.StatusNotFound, CodeNotFound, err.Error())
+	case errors.Is(err, repository.ErrInvalidCursor):
+		return newProblem(http.StatusBadRequest, CodeInvalidCursor, err.Error())
+	case errors.As(err, &brokerE):
+		return newProblem(http.StatusBadGateway, CodeBrokerUnavailable, "message broker unavailable")
+	default:
+		return newProblem(http.StatusInternalServerError, CodeInternal, "")
+	}
+}
+
+func newProblem(status int, code, detail string) Problem {
+	return Problem{Type: "about:blank", Title: http.StatusText(status), Status: status, Code: code, Detail: detail}
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		if apiErr.allow != "" {
+			w.Header().Set("Allow", apiErr.allow)
+		}
+		if apiErr.status == http.StatusUnauthorized {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+		}
+	}
+	writeProblem(w, r, problemFor(err))
+}
+
+func writeProblem(w http.ResponseWriter, r *http.Request, p Problem) {
+	p.Instance = r.URL.Path
+	p.RequestID = requestID(w, r)
+	span := trace.SpanFromContext(r.Context())
+	span.SetAttributes(attribute.String("error.code", p.Code))
+	if p.Status >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, p.Code)
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(p.Status)
+	_ = json.NewEncoder(w).Encode(p)
+}
+
+// requestID returns the ID assigned by the RequestID middleware, falling
+// back to one of its own for handlers served without it.
+func requestID(w http.ResponseWriter, r *http.Request) string {
+	if id := logging.RequestID(r.Context()); id != "" {
+		return id
+	}
+	id := r.Header.Get("X-Request-ID")
+	if !validRequestID(id) {
+		id = logging.NewRequestID()
+	}
+	w.Header().Set("X-Request-ID", id)
+	return id
+}
@@ -1,52 +1,268 @@
 package cache
 
 import (
+	"container/list"
+	"context"
 	"hash/fnv"
 	"runtime"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/neptship/wbtech-orders/internal/models"
 )
 
 type Cache interface {
 	Set(id string, order models.Order)
+	SetWithTTL(id string, order models.Order, ttl time.Duration)
 	Get(id string) (models.Order, bool)
+	GetByRID(rid string) (models.Order, bool)
+	Stats() Stats
 }
 
+type Stats struct {
+	Size        int
+	Capacity    int
+	Hits        uint64
+	Misses      uint64
+	Evictions   uint64
+	Expirations uint64
+}
+
+type entry struct {
+	id        string
+	order     models.Order
+	expiresAt time.Time
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
+
+// shard is an LRU list guarded by its own lock; the front of ll is the most
+// recently used entry. byRID maps the item rids of the shard's orders to their
+// entries. capacity <= 0 means the shard is unbounded.
 type shard struct {
-	mu    sync.RWMutex
-	store map[string]models.Order
+	mu       sync.Mutex
+	store    map[string]*list.Element
+	byRID    map[string]*list.Element
+	ll       *list.List
+	capacity int
 }
 
 type MyCache struct {
-	shards []shard
+	shards      []shard
+	capacity    int
+	ttl         time.Duration
+	now         func() time.Time
+	hits        atomic.Uint64
+	misses      atomic.Uint64
+	evictions   atomic.Uint64
+	expirations atomic.Uint64
 }
 
-func NewCache(_ int) Cache {
+// NewCache returns a sharded LRU cache holding at most size orders in total.
+// A size <= 0 disables eviction, a ttl <= 0 keeps entries until evicted.
+func NewCache(size int, ttl time.Duration) *MyCache {
 	n := runtime.NumCPU() * 2
 	if n < 4 {
 		n = 4
 	}
+	if size > 0 && size < n {
+		n = size
+	}
 	ss := make([]shard, n)
 	for i := range ss {
-		ss[i] = shard{store: make(map[string]models.Order)}
+		capacity := 0
+		if size > 0 {
+			capacity = size / n
+			if i < size%n {
+				capacity++
+			}
+		}
+		ss[i] = shard{store: make(map[string]*list.Element), byRID: make(map[string]*list.Element), ll: list.New(), capacity: capacity}
+	}
+	return &MyCache{
+		shards:   ss,
+		capacity: size,
+		ttl:      ttl,
+		now:      time.Now,
 	}
-	return &MyCache{shards: ss}
 }
 
 func (c *MyCache) Set(id string, order models.Order) {
+	c.SetWithTTL(id, order, c.ttl)
+}
+
+// SetWithTTL stores order with its own time-to-live instead of the cache
+// default; ttl <= 0 stores it without expiry.
+func (c *MyCache) SetWithTTL(id string, order models.Order, ttl time.Duration) {
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = c.now().Add(ttl)
+	}
 	s := c.shardFor(id)
 	s.mu.Lock()
-	s.store[id] = order
+	if el, ok := s.store[id]; ok {
+		e := el.Value.(*entry)
+		s.unindex(el)
+		e.order, e.expiresAt = order, expiresAt
+		s.index(el)
+		s.ll.MoveToFront(el)
+		s.mu.Unlock()
+		return
+	}
+	el := s.ll.PushFront(&entry{id: id, order: order, expiresAt: expiresAt})
+	s.store[id] = el
+	s.index(el)
+	var evicted uint64
+	for s.capacity > 0 && s.ll.Len() > s.capacity {
+		c.remove(s, s.ll.Back())
+		evicted++
+	}
 	s.mu.Unlock()
+	if evicted > 0 {
+		c.evictions.Add(evicted)
+	}
 }
 
 func (c *MyCache) Get(id string) (models.Order, bool) {
 	s := c.shardFor(id)
-	s.mu.RLock()
-	v, ok := s.store[id]
-	s.mu.RUnlock()
-	return v, ok
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.store[id]
+	if ok {
+		var o models.Order
+		if o, ok = c.use(s, el); ok {
+			c.hits.Add(1)
+			return o, true
+		}
+	}
+	c.misses.Add(1)
+	return models.Order{}, false
+}
+
+// GetByRID returns the cached order containing the item with the given rid.
+// It is not a lookup by id, so it counts neither a hit nor a miss.
+func (c *MyCache) GetByRID(rid string) (models.Order, bool) {
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		el, ok := s.byRID[rid]
+		if ok {
+			var o models.Order
+			if o, ok = c.use(s, el); ok {
+				s.mu.Unlock()
+				return o, true
+			}
+		}
+		s.mu.Unlock()
+	}
+	return models.Order{}, false
+}
+
+// use returns the order of el and marks it recently used, or drops el if it
+// has expired; s.mu must be held.
+func (c *MyCache) use(s *shard, el *list.Element) (models.Order, bool) {
+	e := el.Value.(*entry)
+	if e.expired(c.now()) {
+		c.remove(s, el)
+		c.expirations.Add(1)
+		return models.Order{}, false
+	}
+	s.ll.MoveToFront(el)
+	return e.order, true
+}
+
+// StartJanitor sweeps expired entries every interval until ctx is done.
+func (c *MyCache) StartJanitor(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				c.DeleteExpired()
+			}
+		}
+	}()
+}
+
+// DeleteExpired removes every expired entry and returns how many were removed.
+func (c *MyCache) DeleteExpired() int {
+	now := c.now()
+	removed := 0
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		for el := s.ll.Back(); el != nil; {
+			prev := el.Prev()
+			if el.Value.(*entry).expired(now) {
+				c.remove(s, el)
+				removed++
+			}
+			el = prev
+		}
+		s.mu.Unlock()
+	}
+	if removed > 0 {
+		c.expirations.Add(uint64(removed))
+	}
+	return removed
+}
+
+func (c *MyCache) Len() int {
+	n := 0
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		n += s.ll.Len()
+		s.mu.Unlock()
+	}
+	return n
+}
+
+func (c *MyCache) Stats() Stats {
+	return Stats{
+		Size:        c.Len(),
+		Capacity:    c.capacity,
+		Hits:        c.hits.Load(),
+		Misses:      c.misses.Load(),
+		Evictions:   c.evictions.Load(),
+		Expirations: c.expirations.Load(),
+	}
+}
+
+// remove drops el from s and from its rid index; s.mu must be held.
+func (c *MyCache) remove(s *shard, el *list.Element) {
+	e := el.Value.(*entry)
+	s.ll.Remove(el)
+	delete(s.store, e.id)
+	s.unindex(el)
+}
+
+// index adds the item rids of el's order to s.byRID; s.mu must be held.
+func (s *shard) index(el *list.Element) {
+	for _, it := range el.Value.(*entry).order.Items {
+		if it.RID != "" {
+			s.byRID[it.RID] = el
+		}
+	}
+}
+
+// unindex removes the item rids of el's order that still point at el from
+// s.byRID; s.mu must be held.
+func (s *shard) unindex(el *list.Element) {
+	for _, it := range el.Value.(*entry).order.Items {
+		if s.byRID[it.RID] == el {
+			delete(s.byRID, it.RID)
+		}
+	}
 }
 
 func (c *MyCache) shardFor(id string) *shard {
@@ -0,0 +1,127 @@
+package cache_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/neptship/wbtech-orders/internal/cache"
+	"github.com/neptship/wbtech-orders/internal/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	c := cache.NewCache(1, 0)
+
+	c.Set("a", models.Order{OrderUID: "a"})
+	c.Set("b", models.Order{OrderUID: "b"})
+
+	_, ok := c.Get("a")
+	require.False(t, ok)
+	got, ok := c.Get("b")
+	require.True(t, ok)
+	require.Equal(t, "b", got.OrderUID)
+	st := c.Stats()
+	require.Equal(t, 1, st.Size)
+	require.Equal(t, uint64(1), st.Evictions)
+}
+
+func TestCache_BoundedSize(t *testing.T) {
+	c := cache.NewCache(100, 0)
+	for i := 0; i < 1000; i++ {
+		id := fmt.Sprintf("order-%d", i)
+		c.Set(id, models.Order{OrderUID: id})
+	}
+	st := c.Stats()
+	require.LessOrEqual(t, st.Size, 100)
+	require.Equal(t, uint64(1000-st.Size), st.Evictions)
+}
+
+func TestCache_Unbounded(t *testing.T) {
+	c := cache.NewCache(0, 0)
+	for i := 0; i < 1000; i++ {
+		id := fmt.Sprintf("order-%d", i)
+		c.Set(id, models.Order{OrderUID: id})
+	}
+	require.Equal(t, 1000, c.Len())
+	require.Zero(t, c.Stats().Evictions)
+}
+
+func TestCache_ExpiresOnGet(t *testing.T) {
+	c := cache.NewCache(10, 20*time.Millisecond)
+	c.Set("a", models.Order{OrderUID: "a"})
+	c.SetWithTTL("b", models.Order{OrderUID: "b"}, 0)
+
+	_, ok := c.Get("a")
+	require.True(t, ok)
+	time.Sleep(30 * time.Millisecond)
+
+	_, ok = c.Get("a")
+	require.False(t, ok)
+	_, ok = c.Get("b")
+	require.True(t, ok)
+	st := c.Stats()
+	require.Equal(t, uint64(1), st.Expirations)
+	require.Equal(t, uint64(2), st.Hits)
+	require.Equal(t, uint64(1), st.Misses)
+}
+
+func TestCache_DeleteExpired(t *testing.T) {
+	c := cache.NewCache(0, time.Hour)
+	c.SetWithTTL("a", models.Order{OrderUID: "a"}, 10*time.Millisecond)
+	c.SetWithTTL("b", models.Order{OrderUID: "b"}, 10*time.Millisecond)
+	c.Set("c", models.Order{OrderUID: "c"})
+	time.Sleep(20 * time.Millisecond)
+
+	require.Equal(t, 2, c.DeleteExpired())
+	require.Equal(t, 1, c.Len())
+}
+
+func TestCache_RIDIndex(t *testing.T) {
+	c := cache.NewCache(0, 0)
+	o := models.Order{OrderUID: "a", Items: []models.Item{{RID: "r1"}, {RID: "r2"}}}
+	c.Set("a", o)
+
+	got, ok := c.GetByRID("r2")
+	require.True(t, ok)
+	require.Equal(t, "a", got.OrderUID)
+
+	o.Items = []models.Item{{RID: "r3"}}
+	c.Set("a", o)
+
+	_, ok = c.GetByRID("r1")
+	require.False(t, ok)
+	_, ok = c.GetByRID("r3")
+	require.True(t, ok)
+}
+
+func TestCache_RIDIndexDoesNotCountHits(t *testing.T) {
+	c := cache.NewCache(0, 0)
+	c.Set("a", models.Order{OrderUID: "a", Items: []models.Item{{RID: "r1"}}})
+
+	c.GetByRID("r1")
+	c.GetByRID("r2")
+
+	st := c.Stats()
+	require.Zero(t, st.Hits)
+	require.Zero(t, st.Misses)
+}
+
+func TestCache_RIDIndexFollowsEviction(t *testing.T) {
+	c := cache.NewCache(1, 0)
+	c.Set("a", models.Order{OrderUID: "a", Items: []models.Item{{RID: "r1"}}})
+	c.Set("b", models.Order{OrderUID: "b"})
+
+	_, ok := c.GetByRID("r1")
+	require.False(t, ok)
+}
+
+func TestCache_RIDIndexFollowsExpiry(t *testing.T) {
+	c := cache.NewCache(0, 10*time.Millisecond)
+	c.Set("a", models.Order{OrderUID: "a", Items: []models.Item{{RID: "r1"}}})
+	time.Sleep(20 * time.Millisecond)
+
+	_, ok := c.GetByRID("r1")
+	require.False(t, ok)
+	require.Equal(t, uint64(1), c.Stats().Expirations)
+}
@@ -2,19 +2,23 @@ package config
 
 import (
 	"fmt"
-	"log"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	Postgres PostgresConfig
-	Kafka    KafkaConfig
-	HTTP     HTTPConfig
-	Cache    CacheConfig
+	Postgres   PostgresConfig
+	Kafka      KafkaConfig
+	HTTP       HTTPConfig
+	Cache      CacheConfig
+	Validation ValidationConfig
+	Log        LogConfig
+	Tracing    TracingConfig
+	Outbox     OutboxConfig
 }
 
 type PostgresConfig struct {
@@ -23,20 +27,68 @@ type PostgresConfig struct {
 	User     string
 	Password string
 	DBName   string
+	// Layout is "jsonb" or "normalized"; see repository.NewPostgresNormalized.
+	Layout string
+	// AutoMigrate applies pending migrations on startup.
+	AutoMigrate bool
 }
 
 type KafkaConfig struct {
-	Brokers []string
-	Topic   string
-	GroupID string
+	Brokers         []string
+	Topic           string
+	GroupID         string
+	DLQTopic        string
+	RetryBackoff    time.Duration
+	RetryMaxBackoff time.Duration
+	BatchSize       int
+	BatchLinger     time.Duration
+	Concurrency     int
+	MaxInFlight     int
+}
+
+// OutboxConfig switches POST /order_add to writing submissions into the
+// outbox table, from which a relay publishes them to Kafka.
+type OutboxConfig struct {
+	Enabled      bool
+	PollInterval time.Duration
+	BatchSize    int
+	// MaxAttempts is how many failed publishes of a row the relay makes
+	// before it abandons the row.
+	MaxAttempts int
+}
+
+type TracingConfig struct {
+	Exporter    string
+	File        string
+	SampleRatio float64
+}
+
+type LogConfig struct {
+	Level string
 }
 
 type HTTPConfig struct {
-	Port string
+	Port          string
+	ShutdownDelay time.Duration
+	// IdempotencyTTL is how long a response to POST /order_add is kept for
+	// replay under its Idempotency-Key; 0 ignores the header.
+	IdempotencyTTL time.Duration
+	// AdminToken is the bearer token the /dlq endpoints require; they are
+	// disabled while it is empty.
+	AdminToken string
 }
 
 type CacheConfig struct {
-	Size int
+	Size            int
+	TTL             time.Duration
+	JanitorInterval time.Duration
+	WarmupSize      int
+}
+
+// ValidationConfig holds the mode (strict, warn or off) of each payment/items
+// consistency rule, keyed by rule name.
+type ValidationConfig struct {
+	Rules map[string]string
 }
 
 func getenv(key, def string) string {
@@ -50,30 +102,66 @@ func Load() Config {
 	_ = godotenv.Load()
 
 	pg := PostgresConfig{
-		Host:     getenv("POSTGRES_HOST", "localhost"),
-		Port:     parseInt("POSTGRES_PORT", 5432, 1),
-		User:     getenv("POSTGRES_USER", "postgres"),
-		Password: getenv("POSTGRES_PASSWORD", "postgres"),
-		DBName:   getenv("POSTGRES_DB", "orders_data"),
+		Host:        getenv("POSTGRES_HOST", "localhost"),
+		Port:        parseInt("POSTGRES_PORT", 5432, 1),
+		User:        getenv("POSTGRES_USER", "postgres"),
+		Password:    getenv("POSTGRES_PASSWORD", "postgres"),
+		DBName:      getenv("POSTGRES_DB", "orders_data"),
+		Layout:      getenv("POSTGRES_LAYOUT", "jsonb"),
+		AutoMigrate: parseBool("POSTGRES_AUTO_MIGRATE", false),
 	}
 
+	topic := getenv("KAFKA_TOPIC", "orders")
 	kafkaCfg := KafkaConfig{
-		Brokers: strings.Split(getenv("KAFKA_BROKERS", "localhost:9092"), ","),
-		Topic:   getenv("KAFKA_TOPIC", "orders"),
-		GroupID: getenv("KAFKA_GROUP_ID", "order-consumer-group"),
+		Brokers:         strings.Split(getenv("KAFKA_BROKERS", "localhost:9092"), ","),
+		Topic:           topic,
+		DLQTopic:        getenv("KAFKA_DLQ_TOPIC", topic+".dlq"),
+		GroupID:         getenv("KAFKA_GROUP_ID", "order-consumer-group"),
+		RetryBackoff:    parseDuration("KAFKA_RETRY_BACKOFF", 500*time.Millisecond),
+		RetryMaxBackoff: parseDuration("KAFKA_RETRY_MAX_BACKOFF", 30*time.Second),
+		BatchSize:       parseInt("KAFKA_BATCH_SIZE", 1, 1),
+		BatchLinger:     parseDuration("KAFKA_BATCH_LINGER", 100*time.Millisecond),
+		Concurrency:     parseInt("KAFKA_CONCURRENCY", 1, 1),
+		MaxInFlight:     parseInt("KAFKA_MAX_IN_FLIGHT", 100, 1),
 	}
 
 	httpCfg := HTTPConfig{
-		Port: getenv("HTTP_PORT", "8081"),
+		Port:           getenv("HTTP_PORT", "8081"),
+		ShutdownDelay:  parseDuration("HTTP_SHUTDOWN_DELAY", 0),
+		IdempotencyTTL: parseDuration("HTTP_IDEMPOTENCY_TTL", 24*time.Hour),
+		AdminToken:     getenv("HTTP_ADMIN_TOKEN", ""),
 	}
 
+	cacheSize := parseInt("CACHE_SIZE", 1000, 1)
 	cacheCfg := CacheConfig{
-		Size: parseInt("CACHE_SIZE", 1000, 1),
+		Size:            cacheSize,
+		TTL:             parseDuration("CACHE_TTL", 10*time.Minute),
+		JanitorInterval: parseDuration("CACHE_JANITOR_INTERVAL", time.Minute),
+		WarmupSize:      parseInt("CACHE_WARMUP_SIZE", cacheSize, 0),
+	}
+
+	validationCfg := ValidationConfig{
+		Rules: parseMap("VALIDATION_RULES"),
+	}
+
+	logCfg := LogConfig{
+		Level: getenv("LOG_LEVEL", "info"),
+	}
+
+	tracingCfg := TracingConfig{
+		Exporter:    getenv("TRACING_EXPORTER", "none"),
+		File:        getenv("TRACING_FILE", "traces.jsonl"),
+		SampleRatio: parseFloat("TRACING_SAMPLE_RATIO", 1, 0, 1),
+	}
+
+	outboxCfg := OutboxConfig{
+		Enabled:      parseBool("OUTBOX_ENABLED", false),
+		PollInterval: parseDuration("OUTBOX_POLL_INTERVAL", time.Second),
+		BatchSize:    parseInt("OUTBOX_BATCH_SIZE", 100, 1),
+		MaxAttempts:  parseInt("OUTBOX_MAX_ATTEMPTS", 10, 1),
 	}
 
-	cfg := Config{Postgres: pg, Kafka: kafkaCfg, HTTP: httpCfg, Cache: cacheCfg}
-	validate(&cfg)
-	return cfg
+	return Config{Postgres: pg, Kafka: kafkaCfg, HTTP: httpCfg, Cache: cacheCfg, Validation: validationCfg, Log: logCfg, Tracing: tracingCfg, Outbox: outboxCfg}
 }
 
 func parseInt(key string, def, min int) int {
@@ -85,10 +173,71 @@ func parseInt(key string, def, min int) int {
 	return n
 }
 
-func validate(cfg *Config) {
+func parseDuration(key string, def time.Duration) time.Duration {
+	d, err := time.ParseDuration(getenv(key, def.String()))
+	if err != nil || d < 0 {
+		d = def
+	}
+	return d
+}
+
+func parseBool(key string, def bool) bool {
+	b, err := strconv.ParseBool(getenv(key, strconv.FormatBool(def)))
+	if err != nil {
+		b = def
+	}
+	return b
+}
+
+func parseFloat(key string, def, min, max float64) float64 {
+	f, err := strconv.ParseFloat(getenv(key, strconv.FormatFloat(def, 'g', -1, 64)), 64)
+	if err != nil || f < min || f > max {
+		f = def
+	}
+	return f
+}
+
+// parseMap reads a comma-separated list of key=value pairs.
+func parseMap(key string) map[string]string {
+	m := map[string]string{}
+	for _, pair := range strings.Split(getenv(key, ""), ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		m[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return m
+}
+
+// Warnings lists suspicious settings that Load accepted anyway; they are
+// reported once logging is set up.
+func (cfg Config) Warnings() []string {
+	var out []string
 	if len(cfg.Kafka.Brokers) == 0 || cfg.Kafka.Brokers[0] == "" {
-		log.Println("warning: no Kafka brokers configured")
+		out = append(out, "no Kafka brokers configured")
+	}
+	if cfg.Kafka.BatchSize > 1 && cfg.Kafka.Concurrency > 1 {
+		out = append(out, "KAFKA_CONCURRENCY is ignored in batch mode (KAFKA_BATCH_SIZE > 1)")
+	}
+	switch cfg.Postgres.Layout {
+	case "jsonb", "normalized":
+	default:
+		out = append(out, fmt.Sprintf("unknown storage layout %q, using jsonb", cfg.Postgres.Layout))
+	}
+	for rule, mode := range cfg.Validation.Rules {
+		switch mode {
+		case "strict", "warn", "off":
+		default:
+			out = append(out, fmt.Sprintf("unknown mode %q for validation rule %s", mode, rule))
+		}
+	}
+	switch cfg.Tracing.Exporter {
+	case "none", "stdout", "file":
+	default:
+		out = append(out, fmt.Sprintf("unknown tracing exporter %q, tracing disabled", cfg.Tracing.Exporter))
 	}
+	return out
 }
 
 func GetDSN(p PostgresConfig) string {
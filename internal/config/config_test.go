@@ -0,0 +1,16 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad_DLQTopicDefaultsToTopic(t *testing.T) {
+	t.Setenv("KAFKA_TOPIC", "payments")
+	t.Setenv("KAFKA_DLQ_TOPIC", "")
+	require.Equal(t, "payments.dlq", Load().Kafka.DLQTopic)
+
+	t.Setenv("KAFKA_DLQ_TOPIC", "dead-letters")
+	require.Equal(t, "dead-letters", Load().Kafka.DLQTopic)
+}
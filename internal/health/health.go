@@ -0,0 +1,59 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+)
+
+type Check func(ctx context.Context) error
+
+type Result struct {
+	Status    string `json:"status"`
+	LatencyMS int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+func (r Report) OK() bool { return r.Status == StatusOK }
+
+// Run executes checks concurrently, each bounded by timeout, and is OK only
+// if every check passed.
+func Run(ctx context.Context, timeout time.Duration, checks map[string]Check) Report {
+	rep := Report{Status: StatusOK, Checks: make(map[string]Result, len(checks))}
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check Check) {
+			defer wg.Done()
+			cctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			start := time.Now()
+			err := check(cctx)
+			res := Result{Status: StatusOK, LatencyMS: time.Since(start).Milliseconds()}
+			if err != nil {
+				res.Status, res.Error = StatusUnavailable, err.Error()
+			}
+			mu.Lock()
+			rep.Checks[name] = res
+			if err != nil {
+				rep.Status = StatusUnavailable
+			}
+			mu.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+	return rep
+}
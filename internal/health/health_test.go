@@ -0,0 +1,35 @@
+package health_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/neptship/wbtech-orders/internal/health"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	rep := health.Run(context.Background(), 50*time.Millisecond, map[string]health.Check{
+		"postgres": func(context.Context) error { return nil },
+		"kafka":    func(context.Context) error { return errors.New("dial tcp: connection refused") },
+		"slow": func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	})
+
+	require.False(t, rep.OK())
+	require.Equal(t, health.StatusOK, rep.Checks["postgres"].Status)
+	require.Equal(t, health.StatusUnavailable, rep.Checks["kafka"].Status)
+	require.Equal(t, "dial tcp: connection refused", rep.Checks["kafka"].Error)
+	require.Equal(t, context.DeadlineExceeded.Error(), rep.Checks["slow"].Error)
+}
+
+func TestRun_AllHealthy(t *testing.T) {
+	rep := health.Run(context.Background(), time.Second, map[string]health.Check{
+		"postgres": func(context.Context) error { return nil },
+	})
+	require.True(t, rep.OK())
+}
@@ -0,0 +1,186 @@
+package kafka
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/neptship/wbtech-orders/internal/metrics"
+	"github.com/neptship/wbtech-orders/internal/models"
+	"github.com/neptship/wbtech-orders/internal/repository"
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// pending is a message of a batch: a valid one waiting for the bulk upsert,
+// or one that was rejected with err.
+type pending struct {
+	ctx   context.Context
+	span  trace.Span
+	m     kafka.Message
+	order models.Order
+	err   error
+	// failed is set once the message was counted as failed.
+	failed bool
+}
+
+// runBatches is Run in batch mode. Offsets of a batch are committed together
+// once every message in it is stored or dead-lettered.
+func (c *Consumer) runBatches(ctx context.Context) {
+	for {
+		batch, ok := c.fetchBatch(ctx)
+		if !ok {
+			return
+		}
+		start := time.Now()
+		if !c.processBatch(ctx, batch) {
+			slog.InfoContext(ctx, "kafka consumer stopping, batch left uncommitted", "size", len(batch))
+			return
+		}
+		for range batch {
+			metrics.ObserveSince(ctx, consumerDuration, start)
+		}
+		c.commit(ctx, batch...)
+	}
+}
+
+// fetchBatch blocks for one message, then keeps collecting until the batch is
+// full or the linger time has passed.
+func (c *Consumer) fetchBatch(ctx context.Context) ([]kafka.Message, bool) {
+	m, ok := c.fetch(ctx)
+	if !ok {
+		return nil, false
+	}
+	batch := []kafka.Message{m}
+	lctx, cancel := context.WithTimeout(ctx, c.linger)
+	defer cancel()
+	for len(batch) < c.batchSize {
+		m, err := c.reader.FetchMessage(lctx)
+		if err != nil {
+			break
+		}
+		consumerLag.WithLabelValues(strconv.Itoa(m.Partition)).Set(float64(m.HighWaterMark - m.Offset - 1))
+		batch = append(batch, m)
+	}
+	return batch, true
+}
+
+// processBatch validates every message, dead-letters the rejected ones and
+// stores the rest with one SaveBatch call. If the batch as a whole is refused
+// by the database, its orders are stored one by one so that only the
+// offending ones end up in the dead-letter topic.
+func (c *Consumer) processBatch(ctx context.Context, batch []kafka.Message) bool {
+	var (
+		valid    []pending
+		invalid  []pending
+		consumed []repository.Consumed
+	)
+	defer func() {
+		for _, p := range valid {
+			p.span.End()
+		}
+	}()
+	for _, m := range batch {
+		mctx, span := c.startMessage(ctx, m)
+		order, err := c.decode(mctx, m)
+		if err == nil {
+			consumed = append(consumed, repository.Consumed{OrderUID: order.OrderUID, Partition: m.Partition, Offset: m.Offset})
+			err = c.validate(mctx, order)
+		}
+		p := pending{ctx: mctx, span: span, m: m, order: order, err: err}
+		if err != nil {
+			invalid = append(invalid, p)
+		} else {
+			valid = append(valid, p)
+		}
+	}
+	c.trackConsumed(ctx, consumed)
+	for i, p := range invalid {
+		ok := c.retry(p.ctx, p.m, false, func() error { return p.err })
+		p.span.End()
+		if !ok {
+			for _, q := range invalid[i+1:] {
+				q.span.End()
+			}
+			return false
+		}
+	}
+	if len(valid) == 0 {
+		return true
+	}
+
+	skipped, err := c.saveBatch(ctx, valid)
+	if ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "batch upsert rejected, storing orders one by one", "size", len(valid), "err", err)
+		for _, p := range valid {
+			if !c.retry(p.ctx, p.m, p.failed, func() error { return c.save(p.ctx, p.m, p.order) }) {
+				return false
+			}
+		}
+		return true
+	}
+	for i, p := range valid {
+		if reason := skipReason(skipped[i]); reason != "" {
+			c.skip(p.ctx, p.m, p.order, reason)
+		} else {
+			c.stored(p.ctx, p.m, p.order)
+		}
+		consumerMessages.WithLabelValues("processed").Inc()
+	}
+	return true
+}
+
+// saveBatch upserts the orders of valid, retrying transient failures. Once
+// the batch is written it returns which orders were skipped, see
+// OrderRepository.SaveBatch; otherwise the error of a permanent failure or of
+// ctx being cancelled.
+func (c *Consumer) saveBatch(ctx context.Context, valid []pending) ([]error, error) {
+	orders := make([]models.Order, len(valid))
+	links := make([]trace.Link, len(valid))
+	for i, p := range valid {
+		orders[i] = p.order
+		links[i] = trace.LinkFromContext(p.ctx)
+	}
+	delay := c.backoff
+	for attempt := 1; ; attempt++ {
+		sctx, span := tracer.Start(ctx, "OrderRepository.SaveBatch",
+			trace.WithLinks(links...), trace.WithAttributes(attribute.Int("batch.size", len(orders))))
+		skipped, err := c.repo.SaveBatch(sctx, orders)
+		endSpan(span, err)
+		if err == nil || ctx.Err() != nil || !repository.IsTransient(err) {
+			return skipped, err
+		}
+		if attempt == 1 {
+			for i := range valid {
+				valid[i].failed = true
+			}
+			consumerMessages.WithLabelValues("failed").Add(float64(len(orders)))
+		}
+		consumerRetries.Add(float64(len(orders)))
+		slog.WarnContext(ctx, "batch upsert failed, retrying",
+			"size", len(orders), "attempt", attempt, "retry_in", delay.String(), "err", err)
+		if !c.wait(ctx, &delay) {
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// trackConsumed records the decoded orders of a batch as consumed with one
+// statement, best effort like track.
+func (c *Consumer) trackConsumed(ctx context.Context, consumed []repository.Consumed) {
+	consumed = slices.DeleteFunc(consumed, func(e repository.Consumed) bool { return !repository.Trackable(e.OrderUID) })
+	if c.ingestion == nil || len(consumed) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 2*time.Second)
+	defer cancel()
+	if err := c.ingestion.MarkConsumedBatch(ctx, consumed); err != nil {
+		slog.WarnContext(ctx, "record ingestion status failed", "orders", len(consumed), "err", err)
+	}
+}
@@ -2,108 +2,404 @@ package kafka
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
 	"time"
 
+	"github.com/neptship/wbtech-orders/internal/logging"
+	"github.com/neptship/wbtech-orders/internal/metrics"
 	"github.com/neptship/wbtech-orders/internal/models"
+	"github.com/neptship/wbtech-orders/internal/repository"
 	"github.com/neptship/wbtech-orders/internal/validation"
 	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type ConsumerConfig struct {
-	Brokers []string
-	Topic   string
-	GroupID string
-	DB      *sql.DB
+	Brokers         []string
+	Topic           string
+	GroupID         string
+	Repo            repository.OrderRepository
+	Ingestion       repository.IngestionRepository
+	DLQ             *Producer
+	Rules           validation.Rules
+	RetryBackoff    time.Duration
+	RetryMaxBackoff time.Duration
+	// BatchSize > 1 enables batch mode: up to BatchSize messages, collected
+	// for at most BatchLinger, are stored with one bulk upsert.
+	BatchSize   int
+	BatchLinger time.Duration
+	// Concurrency > 1 processes messages with that many workers, keeping
+	// messages with the same key in order; at most MaxInFlight messages are
+	// fetched but not yet finished. Ignored in batch mode.
+	Concurrency int
+	MaxInFlight int
+}
+
+type messageReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+type deadLetterPublisher interface {
+	PublishWithHeaders(ctx context.Context, key string, value []byte, headers ...kafka.Header) error
 }
 
 type Consumer struct {
-	reader  *kafka.Reader
-	db      *sql.DB
-	OnSaved func(order models.Order)
+	reader     messageReader
+	brokers    []string
+	topic      string
+	repo       repository.OrderRepository
+	ingestion  repository.IngestionRepository
+	dlq        deadLetterPublisher
+	rules      validation.Rules
+	backoff    time.Duration
+	maxBackoff time.Duration
+	batchSize  int
+	linger     time.Duration
+	workers    int
+	maxPending int
+	OnSaved    func(order models.Order)
+	// OnRejected is called with the message key once an unstorable message
+	// has been dead-lettered.
+	OnRejected func(key, reason string, err error)
+	// OnSkipped is called for an order that was not stored because it is a
+	// duplicate or an older revision of the stored one.
+	OnSkipped func(order models.Order, reason string)
+}
+
+// Reasons an order is skipped rather than stored.
+const (
+	ReasonDuplicate = "duplicate"
+	ReasonStale     = "stale_revision"
+)
+
+func skipReason(err error) string {
+	switch {
+	case errors.Is(err, repository.ErrDuplicate):
+		return ReasonDuplicate
+	case errors.Is(err, repository.ErrStale):
+		return ReasonStale
+	}
+	return ""
 }
 
+// rejection marks a message that can never be stored; it is moved to the
+// dead-letter topic instead of being retried.
+type rejection struct {
+	orderUID string
+	reason   string
+	err      error
+}
+
+func (r *rejection) Error() string { return r.reason + ": " + r.err.Error() }
+func (r *rejection) Unwrap() error { return r.err }
+
 func NewConsumer(cfg ConsumerConfig) *Consumer {
 	reader := kafka.NewReader(kafka.ReaderConfig{
 		Brokers: cfg.Brokers,
 		Topic:   cfg.Topic,
 		GroupID: cfg.GroupID,
 	})
-	return &Consumer{reader: reader, db: cfg.DB}
+	c := &Consumer{
+		reader:     reader,
+		brokers:    cfg.Brokers,
+		topic:      cfg.Topic,
+		repo:       cfg.Repo,
+		ingestion:  cfg.Ingestion,
+		rules:      cfg.Rules,
+		backoff:    cfg.RetryBackoff,
+		maxBackoff: cfg.RetryMaxBackoff,
+		batchSize:  cfg.BatchSize,
+		linger:     cfg.BatchLinger,
+		workers:    cfg.Concurrency,
+		maxPending: cfg.MaxInFlight,
+	}
+	if cfg.DLQ != nil {
+		c.dlq = cfg.DLQ
+	}
+	if c.backoff <= 0 {
+		c.backoff = 500 * time.Millisecond
+	}
+	if c.maxBackoff < c.backoff {
+		c.maxBackoff = c.backoff
+	}
+	if c.linger <= 0 {
+		c.linger = 100 * time.Millisecond
+	}
+	if c.maxPending < c.workers {
+		c.maxPending = c.workers
+	}
+	return c
 }
 
+// Run consumes with at-least-once semantics: an offset is committed only
+// once its order is stored or known to be unstorable, so a crash or a
+// database outage leads to redelivery rather than loss.
 func (c *Consumer) Run(ctx context.Context) {
-	log.Printf("Kafka consumer started for topic %s", c.reader.Config().Topic)
+	slog.Info("kafka consumer started", "topic", c.topic, "batch_size", c.batchSize, "concurrency", c.workers)
 	if ctx == nil {
 		ctx = context.Background()
 	}
+	switch {
+	case c.batchSize > 1:
+		c.runBatches(ctx)
+		return
+	case c.workers > 1:
+		c.runParallel(ctx)
+		return
+	}
 	for {
-		if err := ctx.Err(); err != nil {
-			log.Printf("consumer context done: %v", err)
+		m, ok := c.fetch(ctx)
+		if !ok {
 			return
 		}
-		m, err := c.reader.ReadMessage(ctx)
+		start := time.Now()
+		mctx, span := c.startMessage(ctx, m)
+		ok = c.process(mctx, m)
+		span.End()
+		if !ok {
+			slog.InfoContext(mctx, "kafka consumer stopping, offset left uncommitted", "partition", m.Partition, "offset", m.Offset)
+			return
+		}
+		metrics.ObserveSince(mctx, consumerDuration, start)
+		c.commit(mctx, m)
+	}
+}
+
+// fetch blocks for the next message, retrying read errors; it returns false
+// once ctx is done.
+func (c *Consumer) fetch(ctx context.Context) (kafka.Message, bool) {
+	for {
+		if err := ctx.Err(); err != nil {
+			slog.Info("kafka consumer stopping", "reason", err)
+			return kafka.Message{}, false
+		}
+		m, err := c.reader.FetchMessage(ctx)
 		if err != nil {
 			if ctx.Err() != nil {
-				log.Printf("consumer stopping (read cancelled): %v", ctx.Err())
-				return
+				slog.Info("kafka consumer stopping", "reason", ctx.Err())
+				return kafka.Message{}, false
 			}
-			log.Printf("kafka read error: %v", err)
+			slog.Error("kafka read failed", "topic", c.topic, "err", err)
 			time.Sleep(500 * time.Millisecond)
 			continue
 		}
-		var order models.Order
-		if err := json.Unmarshal(m.Value, &order); err != nil {
-			log.Printf("invalid order json: %v", err)
-			continue
+		consumerLag.WithLabelValues(strconv.Itoa(m.Partition)).Set(float64(m.HighWaterMark - m.Offset - 1))
+		return m, true
+	}
+}
+
+func (c *Consumer) commit(ctx context.Context, msgs ...kafka.Message) {
+	if err := c.reader.CommitMessages(ctx, msgs...); err != nil {
+		last := msgs[len(msgs)-1]
+		slog.ErrorContext(ctx, "kafka commit failed", "partition", last.Partition, "offset", last.Offset, "err", err)
+	}
+}
+
+// startMessage returns the context for processing m: its request ID and a
+// span continuing the trace started by the producer.
+func (c *Consumer) startMessage(ctx context.Context, m kafka.Message) (context.Context, trace.Span) {
+	ctx = logging.WithRequestID(ctx, headerValue(m.Headers, HeaderRequestID))
+	ctx = otel.GetTextMapPropagator().Extract(ctx, headerCarrier{&m.Headers})
+	return tracer.Start(ctx, c.topic+" process", trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "kafka"),
+			attribute.String("messaging.destination.name", m.Topic),
+			attribute.Int("messaging.kafka.destination.partition", m.Partition),
+			attribute.Int64("messaging.kafka.message.offset", m.Offset),
+		))
+}
+
+// process handles m until it is either stored or dead-lettered, retrying
+// transient failures with exponential backoff. m is decoded, validated and
+// recorded as consumed only once. It returns false only when ctx is cancelled
+// first.
+func (c *Consumer) process(ctx context.Context, m kafka.Message) bool {
+	order, err := c.prepare(ctx, m)
+	return c.retry(ctx, m, false, func() error {
+		if err != nil {
+			return err
 		}
-		if err := validation.Basic(order); err != nil {
-			log.Printf("skip invalid order: %v", err)
-			continue
+		return c.save(ctx, m, order)
+	})
+}
+
+// retry runs fn until it succeeds or yields a rejection that has been
+// dead-lettered. failed tells whether m was already counted as failed, which
+// happens at most once per message; every further attempt counts as a retry.
+func (c *Consumer) retry(ctx context.Context, m kafka.Message, failed bool, fn func() error) bool {
+	delay := c.backoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		var rej *rejection
+		if errors.As(err, &rej) {
+			if err = c.reject(ctx, m, rej); err == nil {
+				return true
+			}
 		}
-		deliveryJSON, err1 := json.Marshal(order.Delivery)
-		paymentJSON, err2 := json.Marshal(order.Payment)
-		itemsJSON, err3 := json.Marshal(order.Items)
-		if err1 != nil || err2 != nil || err3 != nil {
-			log.Printf("marshal error")
-			continue
+		if err == nil {
+			consumerMessages.WithLabelValues("processed").Inc()
+			return true
 		}
-		_, err = c.db.Exec(`
-			INSERT INTO orders (
-				order_uid, track_number, entry, delivery, payment, items, locale,
-				internal_signature, customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard
-			) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14)
-			ON CONFLICT (order_uid) DO UPDATE SET
-				track_number=EXCLUDED.track_number,
-				entry=EXCLUDED.entry,
-				delivery=EXCLUDED.delivery,
-				payment=EXCLUDED.payment,
-				items=EXCLUDED.items,
-				locale=EXCLUDED.locale,
-				internal_signature=EXCLUDED.internal_signature,
-				customer_id=EXCLUDED.customer_id,
-				delivery_service=EXCLUDED.delivery_service,
-				shardkey=EXCLUDED.shardkey,
-				sm_id=EXCLUDED.sm_id,
-				date_created=EXCLUDED.date_created,
-				oof_shard=EXCLUDED.oof_shard
-		`,
-			order.OrderUID, order.TrackNumber, order.Entry,
-			deliveryJSON, paymentJSON, itemsJSON,
-			order.Locale, order.InternalSig, order.CustomerID, order.DeliverySvc,
-			order.ShardKey, order.SmID, order.DateCreated, order.OofShard,
-		)
-		if err != nil {
-			log.Printf("db insert error: %v", err)
-			continue
+		if ctx.Err() != nil {
+			return false
+		}
+		if !failed {
+			failed = true
+			consumerMessages.WithLabelValues("failed").Inc()
+		}
+		consumerRetries.Inc()
+		slog.WarnContext(ctx, "message processing failed, retrying",
+			"partition", m.Partition, "offset", m.Offset, "attempt", attempt, "retry_in", delay.String(), "err", err)
+		if !c.wait(ctx, &delay) {
+			return false
 		}
-		log.Printf("order %s saved", order.OrderUID)
-		if c.OnSaved != nil {
-			c.OnSaved(order)
+	}
+}
+
+func (c *Consumer) reject(ctx context.Context, m kafka.Message, rej *rejection) error {
+	if err := c.deadLetter(ctx, m, rej); err != nil {
+		return err
+	}
+	consumerMessages.WithLabelValues("dead_lettered").Inc()
+	c.track(ctx, rej.orderUID, func(ctx context.Context, ir repository.IngestionRepository) error {
+		return ir.MarkRejected(ctx, rej.orderUID, rej.reason, rej.err.Error())
+	})
+	if c.OnRejected != nil {
+		c.OnRejected(rej.orderUID, rej.reason, rej.err)
+	}
+	return nil
+}
+
+// wait sleeps for *delay and doubles it up to maxBackoff; it returns false if
+// ctx is done first.
+func (c *Consumer) wait(ctx context.Context, delay *time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(*delay):
+	}
+	*delay = min(*delay*2, c.maxBackoff)
+	return true
+}
+
+func (c *Consumer) save(ctx context.Context, m kafka.Message, order models.Order) error {
+	sctx, sspan := tracer.Start(ctx, "OrderRepository.Save", trace.WithAttributes(attribute.String("order.uid", order.OrderUID)))
+	err := c.repo.Save(sctx, order)
+	if reason := skipReason(err); reason != "" {
+		sspan.SetAttributes(attribute.String("order.skipped", reason))
+		sspan.End()
+		c.skip(ctx, m, order, reason)
+		return nil
+	}
+	endSpan(sspan, err)
+	if err != nil {
+		if ctx.Err() == nil && !repository.IsTransient(err) {
+			return &rejection{orderUID: order.OrderUID, reason: ReasonStorageRejected, err: err}
 		}
+		return fmt.Errorf("db insert error: %w", err)
+	}
+	c.stored(ctx, m, order)
+	return nil
+}
+
+// prepare decodes m, records it as consumed and validates it; every error it
+// returns is a rejection.
+func (c *Consumer) prepare(ctx context.Context, m kafka.Message) (models.Order, error) {
+	order, err := c.decode(ctx, m)
+	if err != nil {
+		return order, err
+	}
+	c.track(ctx, order.OrderUID, func(ctx context.Context, ir repository.IngestionRepository) error {
+		return ir.MarkConsumed(ctx, order.OrderUID, m.Partition, m.Offset)
+	})
+	return order, c.validate(ctx, order)
+}
+
+func (c *Consumer) decode(ctx context.Context, m kafka.Message) (models.Order, error) {
+	var order models.Order
+	if err := json.Unmarshal(m.Value, &order); err != nil {
+		return order, &rejection{orderUID: string(m.Key), reason: ReasonInvalidJSON, err: err}
 	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("order.uid", order.OrderUID))
+	return order, nil
+}
+
+func (c *Consumer) validate(ctx context.Context, order models.Order) error {
+	_, vspan := tracer.Start(ctx, "validate order")
+	errs, warnings := validation.Check(order, c.rules)
+	vspan.SetAttributes(attribute.Int("validation.errors", len(errs)), attribute.Int("validation.warnings", len(warnings)))
+	endSpan(vspan, errs.Err())
+	if err := errs.Err(); err != nil {
+		return &rejection{orderUID: order.OrderUID, reason: ReasonValidationFailed, err: err}
+	}
+	if len(warnings) > 0 {
+		slog.WarnContext(ctx, "order flagged by consistency checks", "order_uid", order.OrderUID, "warnings", warnings.Error())
+	}
+	return nil
+}
+
+// stored runs the bookkeeping for an order that is now in the database.
+func (c *Consumer) stored(ctx context.Context, m kafka.Message, order models.Order) {
+	slog.InfoContext(ctx, "order saved", "order_uid", order.OrderUID, "partition", m.Partition, "offset", m.Offset)
+	c.track(ctx, order.OrderUID, func(ctx context.Context, ir repository.IngestionRepository) error {
+		return ir.MarkSaved(ctx, order.OrderUID)
+	})
+	if c.OnSaved != nil {
+		_, cspan := tracer.Start(ctx, "cache update")
+		c.OnSaved(order)
+		cspan.End()
+	}
+}
+
+// skip runs the bookkeeping for an order that was left unstored.
+func (c *Consumer) skip(ctx context.Context, m kafka.Message, order models.Order, reason string) {
+	slog.InfoContext(ctx, "order skipped", "order_uid", order.OrderUID, "reason", reason, "partition", m.Partition, "offset", m.Offset)
+	consumerSkipped.WithLabelValues(reason).Inc()
+	c.track(ctx, order.OrderUID, func(ctx context.Context, ir repository.IngestionRepository) error {
+		return ir.MarkSkipped(ctx, order.OrderUID, reason)
+	})
+	if c.OnSkipped != nil {
+		c.OnSkipped(order, reason)
+	}
+}
+
+// track records an ingestion state change. It is best effort: the status
+// table is for integrators and must never hold up consumption, so it uses its
+// own short deadline and failures are only logged.
+func (c *Consumer) track(ctx context.Context, orderUID string, fn func(ctx context.Context, ir repository.IngestionRepository) error) {
+	if c.ingestion == nil || !repository.Trackable(orderUID) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 2*time.Second)
+	defer cancel()
+	if err := fn(ctx, c.ingestion); err != nil {
+		slog.WarnContext(ctx, "record ingestion status failed", "order_uid", orderUID, "err", err)
+	}
+}
+
+func (c *Consumer) deadLetter(ctx context.Context, m kafka.Message, rej *rejection) error {
+	if c.dlq == nil {
+		slog.WarnContext(ctx, "message skipped", "partition", m.Partition, "offset", m.Offset, "order_uid", rej.orderUID, "reason", rej.reason, "err", rej.err)
+		return nil
+	}
+	if err := c.dlq.PublishWithHeaders(ctx, string(m.Key), m.Value, deadLetterHeaders(m, rej.reason, rej.err)...); err != nil {
+		return fmt.Errorf("dead-letter publish: %w", err)
+	}
+	slog.WarnContext(ctx, "message moved to dead-letter topic", "partition", m.Partition, "offset", m.Offset, "order_uid", rej.orderUID, "reason", rej.reason, "err", rej.err)
+	return nil
+}
+
+// Ping reports whether a broker of the consumer's cluster is reachable.
+func (c *Consumer) Ping(ctx context.Context) error {
+	return ping(ctx, c.brokers)
 }
 
 func (c *Consumer) Close() error {
@@ -0,0 +1,469 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/neptship/wbtech-orders/internal/logging"
+	"github.com/neptship/wbtech-orders/internal/models"
+	"github.com/neptship/wbtech-orders/internal/repository"
+	"github.com/neptship/wbtech-orders/mocks"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const validOrder = `{
+  "order_uid": "b563feb7b2b84b6test",
+  "track_number": "WBILMTESTTRACK",
+  "entry": "WBIL",
+  "delivery": {"name": "Test Testov", "phone": "+9720000000", "zip": "2639809", "city": "Kiryat Mozkin",
+    "address": "Ploshad Mira 15", "region": "Kraiot", "email": "test@gmail.com"},
+  "payment": {"transaction": "b563feb7b2b84b6test", "request_id": "", "currency": "USD", "provider": "wbpay",
+    "amount": 1817, "payment_dt": 1637907727, "bank": "alpha", "delivery_cost": 1500, "goods_total": 317, "custom_fee": 0},
+  "items": [{"chrt_id": 9934930, "track_number": "WBILMTESTTRACK", "price": 453, "rid": "ab4219087a764ae0btest",
+    "name": "Mascaras", "sale": 30, "size": "0", "total_price": 317, "nm_id": 2389212, "brand": "Vivienne Sabo", "status": 202}],
+  "locale": "en",
+  "internal_signature": "",
+  "customer_id": "test",
+  "delivery_service": "meest",
+  "shardkey": "9",
+  "sm_id": 99,
+  "date_created": "2021-11-26T06:22:19Z",
+  "oof_shard": "1"
+}`
+
+func TestConsumer_ProcessSavesThroughRepository(t *testing.T) {
+	repo := mocks.NewOrderRepositoryMock(t)
+	c := &Consumer{repo: repo}
+	var saved []string
+	c.OnSaved = func(o models.Order) { saved = append(saved, o.OrderUID) }
+
+	repo.EXPECT().Save(mock.Anything, mock.MatchedBy(func(o models.Order) bool {
+		return o.OrderUID == "b563feb7b2b84b6test" && o.TrackNumber == "WBILMTESTTRACK"
+	})).Return(nil)
+
+	require.True(t, c.process(context.Background(), kafka.Message{Value: []byte(validOrder)}))
+	require.Equal(t, []string{"b563feb7b2b84b6test"}, saved)
+}
+
+func TestConsumer_PrepareRejectsInvalid(t *testing.T) {
+	c := &Consumer{}
+
+	var rej *rejection
+	_, err := c.prepare(context.Background(), kafka.Message{Value: []byte(`{`)})
+	require.ErrorAs(t, err, &rej)
+	require.Equal(t, ReasonInvalidJSON, rej.reason)
+	_, err = c.prepare(context.Background(), kafka.Message{Value: []byte(`{"order_uid":"x"}`)})
+	require.ErrorAs(t, err, &rej)
+	require.Equal(t, ReasonValidationFailed, rej.reason)
+}
+
+func TestConsumer_ProcessSkipsStaleRevision(t *testing.T) {
+	repo := mocks.NewOrderRepositoryMock(t)
+	ingestion := mocks.NewIngestionRepositoryMock(t)
+	c := &Consumer{repo: repo, ingestion: ingestion}
+	c.OnSaved = func(models.Order) { t.Fatal("OnSaved called for a skipped order") }
+	var skipped []string
+	c.OnSkipped = func(o models.Order, reason string) { skipped = append(skipped, o.OrderUID+"/"+reason) }
+
+	repo.EXPECT().Save(mock.Anything, mock.Anything).Return(repository.ErrStale)
+	ingestion.EXPECT().MarkConsumed(mock.Anything, "b563feb7b2b84b6test", 0, int64(0)).Return(nil)
+	ingestion.EXPECT().MarkSkipped(mock.Anything, "b563feb7b2b84b6test", ReasonStale).Return(nil)
+
+	require.True(t, c.process(context.Background(), kafka.Message{Value: []byte(validOrder)}))
+	require.Equal(t, []string{"b563feb7b2b84b6test/" + ReasonStale}, skipped)
+}
+
+func TestConsumer_SaveError(t *testing.T) {
+	repo := mocks.NewOrderRepositoryMock(t)
+	c := &Consumer{repo: repo}
+	c.OnSaved = func(models.Order) { t.Fatal("OnSaved called after failed save") }
+	dbErr := errors.New("connection refused")
+
+	repo.EXPECT().Save(mock.Anything, mock.Anything).Return(dbErr)
+
+	m := kafka.Message{Value: []byte(validOrder)}
+	order, err := c.prepare(context.Background(), m)
+	require.NoError(t, err)
+	require.ErrorIs(t, c.save(context.Background(), m, order), dbErr)
+}
+
+// fakeReader serves msgs in order, then blocks until ctx is done.
+type fakeReader struct {
+	mu        sync.Mutex
+	msgs      []kafka.Message
+	committed []int64
+	done      chan struct{}
+	drained   sync.Once
+}
+
+func newFakeReader(msgs ...kafka.Message) *fakeReader {
+	return &fakeReader{msgs: msgs, done: make(chan struct{})}
+}
+
+func (r *fakeReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	r.mu.Lock()
+	if len(r.msgs) > 0 {
+		m := r.msgs[0]
+		r.msgs = r.msgs[1:]
+		r.mu.Unlock()
+		return m, nil
+	}
+	r.mu.Unlock()
+	r.drained.Do(func() { close(r.done) })
+	<-ctx.Done()
+	return kafka.Message{}, ctx.Err()
+}
+
+func (r *fakeReader) CommitMessages(_ context.Context, msgs ...kafka.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, m := range msgs {
+		r.committed = append(r.committed, m.Offset)
+	}
+	return nil
+}
+
+func (r *fakeReader) Close() error { return nil }
+
+func runUntilDrained(t *testing.T, c *Consumer, r *fakeReader) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stopped := make(chan struct{})
+	go func() {
+		c.Run(ctx)
+		close(stopped)
+	}()
+	select {
+	case <-r.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("consumer did not drain messages")
+	}
+	cancel()
+	<-stopped
+}
+
+// runUntilCommitted runs c until n offsets are committed; in batch mode the
+// reader drains before the batch is processed.
+func runUntilCommitted(t *testing.T, c *Consumer, r *fakeReader, n int) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stopped := make(chan struct{})
+	go func() {
+		c.Run(ctx)
+		close(stopped)
+	}()
+	require.Eventually(t, func() bool {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return len(r.committed) >= n
+	}, 5*time.Second, time.Millisecond)
+	cancel()
+	<-stopped
+}
+
+func TestConsumer_RunRetriesTransientErrorsBeforeCommit(t *testing.T) {
+	repo := mocks.NewOrderRepositoryMock(t)
+	r := newFakeReader(
+		kafka.Message{Offset: 1, Value: []byte(`not json`)},
+		kafka.Message{Offset: 2, Value: []byte(validOrder)},
+	)
+	c := &Consumer{reader: r, repo: repo, backoff: time.Millisecond, maxBackoff: time.Millisecond}
+
+	repo.EXPECT().Save(mock.Anything, mock.Anything).Return(errors.New("connection refused")).Twice()
+	repo.EXPECT().Save(mock.Anything, mock.Anything).Return(nil).Once()
+
+	runUntilDrained(t, c, r)
+	require.Equal(t, []int64{1, 2}, r.committed)
+}
+
+func TestConsumer_RunLeavesOffsetUncommittedOnShutdown(t *testing.T) {
+	repo := mocks.NewOrderRepositoryMock(t)
+	r := newFakeReader(kafka.Message{Offset: 7, Value: []byte(validOrder)})
+	c := &Consumer{reader: r, repo: repo, backoff: time.Hour, maxBackoff: time.Hour}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	repo.EXPECT().Save(mock.Anything, mock.Anything).
+		RunAndReturn(func(context.Context, models.Order) error {
+			cancel()
+			return errors.New("connection refused")
+		}).Once()
+
+	c.Run(ctx)
+	require.Empty(t, r.committed)
+}
+
+type fakeDLQ struct {
+	fail int
+	msgs []kafka.Message
+}
+
+func (d *fakeDLQ) PublishWithHeaders(_ context.Context, key string, value []byte, headers ...kafka.Header) error {
+	if d.fail > 0 {
+		d.fail--
+		return errors.New("broker unavailable")
+	}
+	d.msgs = append(d.msgs, kafka.Message{Key: []byte(key), Value: value, Headers: headers})
+	return nil
+}
+
+func TestConsumer_RunMovesInvalidMessagesToDLQ(t *testing.T) {
+	repo := mocks.NewOrderRepositoryMock(t)
+	dlq := &fakeDLQ{fail: 1}
+	r := newFakeReader(kafka.Message{Topic: "orders", Partition: 2, Offset: 41, Key: []byte("k"), Value: []byte(`not json`)})
+	c := &Consumer{reader: r, repo: repo, dlq: dlq, backoff: time.Millisecond, maxBackoff: time.Millisecond}
+	var rejected []string
+	c.OnRejected = func(key, reason string, _ error) { rejected = append(rejected, key+"/"+reason) }
+	deadLettered := testutil.ToFloat64(consumerMessages.WithLabelValues("dead_lettered"))
+	failed := testutil.ToFloat64(consumerMessages.WithLabelValues("failed"))
+	retries := testutil.ToFloat64(consumerRetries)
+
+	runUntilDrained(t, c, r)
+
+	require.Equal(t, []int64{41}, r.committed)
+	require.Equal(t, []string{"k/" + ReasonInvalidJSON}, rejected)
+	require.Equal(t, deadLettered+1, testutil.ToFloat64(consumerMessages.WithLabelValues("dead_lettered")))
+	require.Equal(t, failed+1, testutil.ToFloat64(consumerMessages.WithLabelValues("failed")))
+	require.Equal(t, retries+1, testutil.ToFloat64(consumerRetries))
+	require.Len(t, dlq.msgs, 1)
+	got := parseDeadLetter(dlq.msgs[0])
+	require.Equal(t, "not json", got.Payload)
+	require.Equal(t, "k", got.Key)
+	require.Equal(t, ReasonInvalidJSON, got.Reason)
+	require.Equal(t, "orders", got.SourceTopic)
+	require.Equal(t, 2, got.SourcePartition)
+	require.Equal(t, int64(41), got.SourceOffset)
+	require.False(t, got.FailedAt.IsZero())
+}
+
+func TestConsumer_RunTracksIngestionStatus(t *testing.T) {
+	repo := mocks.NewOrderRepositoryMock(t)
+	ingestion := mocks.NewIngestionRepositoryMock(t)
+	r := newFakeReader(
+		kafka.Message{Partition: 3, Offset: 10, Key: []byte("b563feb7b2b84b6test"), Value: []byte(validOrder)},
+		kafka.Message{Partition: 3, Offset: 11, Key: []byte("broken"), Value: []byte(`not json`)},
+	)
+	c := &Consumer{reader: r, repo: repo, ingestion: ingestion, backoff: time.Millisecond, maxBackoff: time.Millisecond}
+
+	repo.EXPECT().Save(mock.Anything, mock.Anything).Return(nil).Once()
+	ingestion.EXPECT().MarkConsumed(mock.Anything, "b563feb7b2b84b6test", 3, int64(10)).Return(nil).Once()
+	ingestion.EXPECT().MarkSaved(mock.Anything, "b563feb7b2b84b6test").Return(nil).Once()
+	ingestion.EXPECT().MarkRejected(mock.Anything, "broken", ReasonInvalidJSON, mock.Anything).
+		Return(errors.New("status table unavailable")).Once()
+
+	runUntilDrained(t, c, r)
+	require.Equal(t, []int64{10, 11}, r.committed)
+}
+
+func TestConsumer_RunMarksConsumedOnceDespiteRetries(t *testing.T) {
+	repo := mocks.NewOrderRepositoryMock(t)
+	ingestion := mocks.NewIngestionRepositoryMock(t)
+	r := newFakeReader(kafka.Message{Partition: 1, Offset: 4, Value: []byte(validOrder)})
+	c := &Consumer{reader: r, repo: repo, ingestion: ingestion, backoff: time.Millisecond, maxBackoff: time.Millisecond}
+
+	repo.EXPECT().Save(mock.Anything, mock.Anything).Return(errors.New("connection refused")).Twice()
+	repo.EXPECT().Save(mock.Anything, mock.Anything).Return(nil).Once()
+	ingestion.EXPECT().MarkConsumed(mock.Anything, "b563feb7b2b84b6test", 1, int64(4)).Return(nil).Once()
+	ingestion.EXPECT().MarkSaved(mock.Anything, "b563feb7b2b84b6test").Return(nil).Once()
+
+	runUntilCommitted(t, c, r, 1)
+}
+
+func TestConsumer_RunSkipsIngestionForUnknownKey(t *testing.T) {
+	ingestion := mocks.NewIngestionRepositoryMock(t)
+	r := newFakeReader(kafka.Message{Offset: 1, Key: []byte(repository.UnknownOrderUID), Value: []byte(`not json`)})
+	c := &Consumer{reader: r, ingestion: ingestion, backoff: time.Millisecond, maxBackoff: time.Millisecond}
+
+	runUntilCommitted(t, c, r, 1)
+}
+
+func TestConsumer_RunCarriesRequestIDIntoContext(t *testing.T) {
+	repo := mocks.NewOrderRepositoryMock(t)
+	r := newFakeReader(kafka.Message{Offset: 1, Value: []byte(validOrder),
+		Headers: []kafka.Header{{Key: HeaderRequestID, Value: []byte("req-9")}}})
+	c := &Consumer{reader: r, repo: repo, backoff: time.Millisecond, maxBackoff: time.Millisecond}
+
+	repo.EXPECT().Save(mock.MatchedBy(func(ctx context.Context) bool {
+		return logging.RequestID(ctx) == "req-9"
+	}), mock.Anything).Return(nil).Once()
+
+	runUntilDrained(t, c, r)
+	require.Equal(t, []int64{1}, r.committed)
+}
+
+func TestConsumer_RunBatchUpsertsValidOrders(t *testing.T) {
+	repo := mocks.NewOrderRepositoryMock(t)
+	r := newFakeReader(
+		kafka.Message{Offset: 1, Value: []byte(validOrder)},
+		kafka.Message{Offset: 2, Key: []byte("broken"), Value: []byte(`not json`)},
+		kafka.Message{Offset: 3, Value: []byte(validOrder)},
+	)
+	c := &Consumer{reader: r, repo: repo, backoff: time.Millisecond, maxBackoff: time.Millisecond,
+		batchSize: 10, linger: 20 * time.Millisecond}
+	var saved int
+	c.OnSaved = func(models.Order) { saved++ }
+
+	repo.EXPECT().SaveBatch(mock.Anything, mock.MatchedBy(func(orders []models.Order) bool {
+		return len(orders) == 2
+	})).Return(nil, errors.New("connection refused")).Once()
+	repo.EXPECT().SaveBatch(mock.Anything, mock.Anything).Return([]error{nil, repository.ErrDuplicate}, nil).Once()
+	var skipped []string
+	c.OnSkipped = func(_ models.Order, reason string) { skipped = append(skipped, reason) }
+
+	runUntilCommitted(t, c, r, 3)
+	require.Equal(t, []int64{1, 2, 3}, r.committed)
+	require.Equal(t, 1, saved)
+	require.Equal(t, []string{ReasonDuplicate}, skipped)
+}
+
+func TestConsumer_RunBatchMarksConsumedInOneCall(t *testing.T) {
+	repo := mocks.NewOrderRepositoryMock(t)
+	ingestion := mocks.NewIngestionRepositoryMock(t)
+	r := newFakeReader(
+		kafka.Message{Partition: 2, Offset: 1, Value: []byte(validOrder)},
+		kafka.Message{Partition: 2, Offset: 2, Key: []byte(repository.UnknownOrderUID), Value: []byte(`not json`)},
+		kafka.Message{Partition: 2, Offset: 3, Value: []byte(strings.ReplaceAll(validOrder, "b563feb7b2b84b6test", "b563feb7b2b84b6tes2"))},
+	)
+	c := &Consumer{reader: r, repo: repo, ingestion: ingestion, backoff: time.Millisecond, maxBackoff: time.Millisecond,
+		batchSize: 3, linger: time.Second}
+
+	ingestion.EXPECT().MarkConsumedBatch(mock.Anything, []repository.Consumed{
+		{OrderUID: "b563feb7b2b84b6test", Partition: 2, Offset: 1},
+		{OrderUID: "b563feb7b2b84b6tes2", Partition: 2, Offset: 3},
+	}).Return(nil).Once()
+	repo.EXPECT().SaveBatch(mock.Anything, mock.Anything).Return(nil, errors.New("connection refused")).Once()
+	repo.EXPECT().SaveBatch(mock.Anything, mock.Anything).Return([]error{nil, nil}, nil).Once()
+	ingestion.EXPECT().MarkSaved(mock.Anything, mock.Anything).Return(nil).Twice()
+
+	runUntilCommitted(t, c, r, 3)
+	require.Equal(t, []int64{1, 2, 3}, r.committed)
+}
+
+func TestConsumer_RunBatchFallsBackToSingleSaves(t *testing.T) {
+	repo := mocks.NewOrderRepositoryMock(t)
+	dlq := &fakeDLQ{}
+	r := newFakeReader(
+		kafka.Message{Offset: 5, Value: []byte(validOrder)},
+		kafka.Message{Offset: 6, Value: []byte(validOrder)},
+	)
+	c := &Consumer{reader: r, repo: repo, dlq: dlq, backoff: time.Millisecond, maxBackoff: time.Millisecond,
+		batchSize: 2, linger: time.Second}
+	constraint := &pq.Error{Code: "23514"}
+
+	repo.EXPECT().SaveBatch(mock.Anything, mock.Anything).Return(nil, constraint).Once()
+	repo.EXPECT().Save(mock.Anything, mock.Anything).Return(nil).Once()
+	repo.EXPECT().Save(mock.Anything, mock.Anything).Return(constraint).Once()
+
+	runUntilCommitted(t, c, r, 2)
+	require.Equal(t, []int64{5, 6}, r.committed)
+	require.Len(t, dlq.msgs, 1)
+	require.Equal(t, ReasonStorageRejected, parseDeadLetter(dlq.msgs[0]).Reason)
+}
+
+func TestOffsetTracker_CommitsOnlyFinishedPrefix(t *testing.T) {
+	tr := newOffsetTracker()
+	msgs := []kafka.Message{{Partition: 0, Offset: 1}, {Partition: 0, Offset: 2}, {Partition: 0, Offset: 3}, {Partition: 1, Offset: 9}}
+	gens := make([]uint64, len(msgs))
+	for i, m := range msgs {
+		gens[i] = tr.start(m)
+	}
+	var commits []int64
+	commit := func(m kafka.Message) { commits = append(commits, m.Offset) }
+
+	tr.finish(msgs[1], gens[1], commit)
+	tr.finish(msgs[2], gens[2], commit)
+	require.Empty(t, commits)
+	tr.finish(msgs[3], gens[3], commit)
+	require.Equal(t, []int64{9}, commits)
+	tr.finish(msgs[0], gens[0], commit)
+	require.Equal(t, []int64{9, 3}, commits)
+}
+
+func TestOffsetTracker_IgnoresFinishOfEarlierGeneration(t *testing.T) {
+	tr := newOffsetTracker()
+	var commits []int64
+	commit := func(m kafka.Message) { commits = append(commits, m.Offset) }
+
+	oldGen := tr.start(kafka.Message{Offset: 5})
+	tr.start(kafka.Message{Offset: 6})
+	// Rebalance: the partition is fetched again from offset 5.
+	newGen := tr.start(kafka.Message{Offset: 5})
+	tr.start(kafka.Message{Offset: 6})
+	require.NotEqual(t, oldGen, newGen)
+
+	tr.finish(kafka.Message{Offset: 5}, oldGen, commit)
+	tr.finish(kafka.Message{Offset: 6}, newGen, commit)
+	require.Empty(t, commits, "offset 5 of the new generation is still in flight")
+	tr.finish(kafka.Message{Offset: 5}, newGen, commit)
+	require.Equal(t, []int64{6}, commits)
+}
+
+func TestOffsetTracker_CommitsNeverGoBackwards(t *testing.T) {
+	tr := newOffsetTracker()
+	var commits []int64
+	commit := func(m kafka.Message) { commits = append(commits, m.Offset) }
+
+	gen := tr.start(kafka.Message{Offset: 7})
+	tr.finish(kafka.Message{Offset: 7}, gen, commit)
+	// The partition is fetched again from an older offset, e.g. after a
+	// rebalance that raced with the commit above.
+	gen = tr.start(kafka.Message{Offset: 7})
+	tr.finish(kafka.Message{Offset: 7}, gen, commit)
+	gen = tr.start(kafka.Message{Offset: 8})
+	tr.finish(kafka.Message{Offset: 8}, gen, commit)
+	require.Equal(t, []int64{7, 8}, commits)
+}
+
+func TestConsumer_RunParallelKeepsKeyOrder(t *testing.T) {
+	repo := mocks.NewOrderRepositoryMock(t)
+	var msgs []kafka.Message
+	for i := range 20 {
+		uid := fmt.Sprintf("b563feb7b2b84b6tes%d", i%4)
+		body := strings.ReplaceAll(validOrder, "b563feb7b2b84b6test", uid)
+		body = strings.Replace(body, `"sm_id": 99`, fmt.Sprintf(`"sm_id": %d`, i), 1)
+		msgs = append(msgs, kafka.Message{Offset: int64(i), Key: []byte(uid), Value: []byte(body)})
+	}
+	r := newFakeReader(msgs...)
+	c := &Consumer{reader: r, repo: repo, backoff: time.Millisecond, maxBackoff: time.Millisecond,
+		workers: 4, maxPending: 8}
+	var mu sync.Mutex
+	seen := map[string][]int{}
+	repo.EXPECT().Save(mock.Anything, mock.Anything).RunAndReturn(func(_ context.Context, o models.Order) error {
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		seen[o.OrderUID] = append(seen[o.OrderUID], o.SmID)
+		mu.Unlock()
+		return nil
+	}).Times(20)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		c.Run(ctx)
+		close(stopped)
+	}()
+	require.Eventually(t, func() bool {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return len(r.committed) > 0 && r.committed[len(r.committed)-1] == 19
+	}, 5*time.Second, time.Millisecond)
+	cancel()
+	<-stopped
+
+	require.Len(t, seen, 4)
+	for uid, ids := range seen {
+		require.Len(t, ids, 5, uid)
+		require.IsIncreasing(t, ids, uid)
+	}
+	require.IsIncreasing(t, r.committed)
+}
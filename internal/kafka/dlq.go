@@ -0,0 +1,261 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+const (
+	HeaderDLQReason          = "dlq-reason"
+	HeaderDLQError           = "dlq-error"
+	HeaderDLQSourceTopic     = "dlq-source-topic"
+	HeaderDLQSourcePartition = "dlq-source-partition"
+	HeaderDLQSourceOffset    = "dlq-source-offset"
+	HeaderDLQTimestamp       = "dlq-timestamp"
+)
+
+const (
+	ReasonInvalidJSON      = "invalid_json"
+	ReasonValidationFailed = "validation_failed"
+	ReasonStorageRejected  = "storage_rejected"
+)
+
+type DeadLetter struct {
+	Partition       int       `json:"partition"`
+	Offset          int64     `json:"offset"`
+	Key             string    `json:"key"`
+	Payload         string    `json:"payload"`
+	Reason          string    `json:"reason"`
+	Error           string    `json:"error"`
+	SourceTopic     string    `json:"source_topic"`
+	SourcePartition int       `json:"source_partition"`
+	SourceOffset    int64     `json:"source_offset"`
+	FailedAt        time.Time `json:"failed_at"`
+}
+
+func withoutDLQHeaders(headers []kafkago.Header) []kafkago.Header {
+	out := make([]kafkago.Header, 0, len(headers)+6)
+	for _, h := range headers {
+		if !strings.HasPrefix(h.Key, "dlq-") {
+			out = append(out, h)
+		}
+	}
+	return out
+}
+
+func deadLetterHeaders(m kafkago.Message, reason string, cause error) []kafkago.Header {
+	return append(withoutDLQHeaders(m.Headers),
+		kafkago.Header{Key: HeaderDLQReason, Value: []byte(reason)},
+		kafkago.Header{Key: HeaderDLQError, Value: []byte(cause.Error())},
+		kafkago.Header{Key: HeaderDLQSourceTopic, Value: []byte(m.Topic)},
+		kafkago.Header{Key: HeaderDLQSourcePartition, Value: []byte(strconv.Itoa(m.Partition))},
+		kafkago.Header{Key: HeaderDLQSourceOffset, Value: []byte(strconv.FormatInt(m.Offset, 10))},
+		kafkago.Header{Key: HeaderDLQTimestamp, Value: []byte(time.Now().UTC().Format(time.RFC3339Nano))},
+	)
+}
+
+func parseDeadLetter(m kafkago.Message) DeadLetter {
+	d := DeadLetter{Partition: m.Partition, Offset: m.Offset, Key: string(m.Key), Payload: string(m.Value)}
+	for _, h := range m.Headers {
+		v := string(h.Value)
+		switch h.Key {
+		case HeaderDLQReason:
+			d.Reason = v
+		case HeaderDLQError:
+			d.Error = v
+		case HeaderDLQSourceTopic:
+			d.SourceTopic = v
+		case HeaderDLQSourcePartition:
+			d.SourcePartition, _ = strconv.Atoi(v)
+		case HeaderDLQSourceOffset:
+			d.SourceOffset, _ = strconv.ParseInt(v, 10, 64)
+		case HeaderDLQTimestamp:
+			d.FailedAt, _ = time.Parse(time.RFC3339Nano, v)
+		}
+	}
+	return d
+}
+
+type DeadLettersConfig struct {
+	Brokers []string
+	Topic   string
+	GroupID string
+	Target  *Producer
+}
+
+// DeadLetters inspects and re-drives the dead-letter topic. Progress is kept
+// as committed offsets of GroupID, so List shows only messages that have not
+// been re-driven yet.
+type DeadLetters struct {
+	cfg    DeadLettersConfig
+	client *kafkago.Client
+}
+
+func NewDeadLetters(cfg DeadLettersConfig) *DeadLetters {
+	return &DeadLetters{
+		cfg:    cfg,
+		client: &kafkago.Client{Addr: kafkago.TCP(cfg.Brokers...), Timeout: 10 * time.Second},
+	}
+}
+
+func (d *DeadLetters) List(ctx context.Context, limit int) ([]DeadLetter, error) {
+	var out []DeadLetter
+	err := d.scan(ctx, limit, func(m kafkago.Message) error {
+		out = append(out, parseDeadLetter(m))
+		return nil
+	}, nil)
+	return out, err
+}
+
+// Redrive republishes up to limit pending dead letters to the main topic
+// without their dlq-* headers and returns how many were sent.
+func (d *DeadLetters) Redrive(ctx context.Context, limit int) (int, error) {
+	if d.cfg.Target == nil {
+		return 0, errors.New("redrive target producer not configured")
+	}
+	n := 0
+	err := d.scan(ctx, limit, func(m kafkago.Message) error {
+		if err := d.cfg.Target.PublishWithHeaders(ctx, string(m.Key), m.Value, withoutDLQHeaders(m.Headers)...); err != nil {
+			return err
+		}
+		n++
+		return nil
+	}, d.commit)
+	return n, err
+}
+
+type partitionRange struct {
+	partition int
+	from, to  int64
+}
+
+// scan walks pending messages partition by partition, calling fn for each and
+// done with the offset to resume from once a partition's share is handled.
+func (d *DeadLetters) scan(ctx context.Context, limit int, fn func(kafkago.Message) error, done func(ctx context.Context, partition int, next int64) error) error {
+	ranges, err := d.pending(ctx)
+	if err != nil {
+		return err
+	}
+	for _, r := range ranges {
+		if limit <= 0 {
+			return nil
+		}
+		next, handled, err := d.read(ctx, r, limit, fn)
+		limit -= handled
+		if next > r.from && done != nil {
+			if cerr := done(ctx, r.partition, next); cerr != nil && err == nil {
+				err = cerr
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *DeadLetters) pending(ctx context.Context) ([]partitionRange, error) {
+	meta, err := d.client.Metadata(ctx, &kafkago.MetadataRequest{Topics: []string{d.cfg.Topic}})
+	if err != nil {
+		return nil, &BrokerError{Op: "dlq metadata", Err: err}
+	}
+	if len(meta.Topics) == 0 {
+		return nil, nil
+	}
+	if meta.Topics[0].Error != nil {
+		if errors.Is(meta.Topics[0].Error, kafkago.UnknownTopicOrPartition) {
+			return nil, nil
+		}
+		return nil, &BrokerError{Op: "dlq metadata", Err: meta.Topics[0].Error}
+	}
+	var (
+		ids      []int
+		requests []kafkago.OffsetRequest
+	)
+	for _, p := range meta.Topics[0].Partitions {
+		ids = append(ids, p.ID)
+		requests = append(requests, kafkago.FirstOffsetOf(p.ID), kafkago.LastOffsetOf(p.ID))
+	}
+	sort.Ints(ids)
+	offsets, err := d.client.ListOffsets(ctx, &kafkago.ListOffsetsRequest{Topics: map[string][]kafkago.OffsetRequest{d.cfg.Topic: requests}})
+	if err != nil {
+		return nil, &BrokerError{Op: "dlq offsets", Err: err}
+	}
+	committed, err := d.client.OffsetFetch(ctx, &kafkago.OffsetFetchRequest{GroupID: d.cfg.GroupID, Topics: map[string][]int{d.cfg.Topic: ids}})
+	if err != nil {
+		return nil, &BrokerError{Op: "dlq committed offsets", Err: err}
+	}
+	from := map[int]int64{}
+	for _, p := range committed.Topics[d.cfg.Topic] {
+		from[p.Partition] = p.CommittedOffset
+	}
+	var out []partitionRange
+	for _, p := range offsets.Topics[d.cfg.Topic] {
+		if p.Error != nil {
+			return nil, &BrokerError{Op: fmt.Sprintf("dlq offsets partition %d", p.Partition), Err: p.Error}
+		}
+		start := p.FirstOffset
+		if c, ok := from[p.Partition]; ok && c > start {
+			start = c
+		}
+		if start < p.LastOffset {
+			out = append(out, partitionRange{partition: p.Partition, from: start, to: p.LastOffset})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].partition < out[j].partition })
+	return out, nil
+}
+
+// read delivers at most limit messages of pr and returns the offset following
+// the last one handled.
+func (d *DeadLetters) read(ctx context.Context, pr partitionRange, limit int, fn func(kafkago.Message) error) (int64, int, error) {
+	r := kafkago.NewReader(kafkago.ReaderConfig{
+		Brokers:   d.cfg.Brokers,
+		Topic:     d.cfg.Topic,
+		Partition: pr.partition,
+		MaxWait:   500 * time.Millisecond,
+	})
+	defer r.Close()
+	if err := r.SetOffset(pr.from); err != nil {
+		return pr.from, 0, &BrokerError{Op: "dlq seek", Err: err}
+	}
+	next, handled := pr.from, 0
+	for next < pr.to && handled < limit {
+		m, err := r.ReadMessage(ctx)
+		if err != nil {
+			return next, handled, &BrokerError{Op: fmt.Sprintf("dlq read partition %d", pr.partition), Err: err}
+		}
+		if m.Offset >= pr.to {
+			break
+		}
+		if err := fn(m); err != nil {
+			return next, handled, err
+		}
+		next, handled = m.Offset+1, handled+1
+	}
+	return next, handled, nil
+}
+
+func (d *DeadLetters) commit(ctx context.Context, partition int, next int64) error {
+	res, err := d.client.OffsetCommit(ctx, &kafkago.OffsetCommitRequest{
+		GroupID:      d.cfg.GroupID,
+		GenerationID: -1,
+		Topics:       map[string][]kafkago.OffsetCommit{d.cfg.Topic: {{Partition: partition, Offset: next}}},
+	})
+	if err != nil {
+		return &BrokerError{Op: "dlq commit", Err: err}
+	}
+	for _, p := range res.Topics[d.cfg.Topic] {
+		if p.Error != nil {
+			return &BrokerError{Op: fmt.Sprintf("dlq commit partition %d", p.Partition), Err: p.Error}
+		}
+	}
+	return nil
+}
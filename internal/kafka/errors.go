@@ -0,0 +1,39 @@
+package kafka
+
+import (
+	"errors"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+// BrokerError is a failure talking to the Kafka cluster, as opposed to a
+// problem with the message or the caller's input.
+type BrokerError struct {
+	Op  string
+	Err error
+}
+
+func (e *BrokerError) Error() string { return e.Op + ": " + e.Err.Error() }
+func (e *BrokerError) Unwrap() error { return e.Err }
+
+// IsMessageRejected reports whether a publish failed because of the message
+// itself, e.g. for being over the broker's message.max.bytes, so that sending
+// it again cannot succeed. For a batch it looks at the first failed message.
+func IsMessageRejected(err error) bool {
+	var werrs kafkago.WriteErrors
+	if errors.As(err, &werrs) {
+		for _, e := range werrs {
+			if e != nil {
+				return IsMessageRejected(e)
+			}
+		}
+		return false
+	}
+	for _, code := range []kafkago.Error{kafkago.MessageSizeTooLarge, kafkago.InvalidMessage,
+		kafkago.InvalidMessageSize, kafkago.InvalidRecord} {
+		if errors.Is(err, code) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package kafka
+
+import (
+	"github.com/neptship/wbtech-orders/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	consumerMessages = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "kafka_consumer_messages_total",
+		Help: "Consumed messages by outcome: processed, dead_lettered or failed (needed a retry; such a message is also counted under its final outcome).",
+	}, []string{"result"})
+	consumerRetries = metrics.Factory.NewCounter(prometheus.CounterOpts{
+		Name: "kafka_consumer_retries_total",
+		Help: "Repeated attempts to process a message after a transient failure.",
+	})
+	consumerSkipped = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "kafka_consumer_skipped_total",
+		Help: "Orders not stored because the stored one is identical (duplicate) or newer (stale_revision).",
+	}, []string{"reason"})
+	consumerLag = metrics.Factory.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kafka_consumer_lag",
+		Help: "Messages behind the partition high watermark as of the last fetched message.",
+	}, []string{"partition"})
+	consumerInFlight = metrics.Factory.NewGauge(prometheus.GaugeOpts{
+		Name: "kafka_consumer_in_flight",
+		Help: "Messages fetched by the parallel consumer and not yet finished.",
+	})
+	consumerDuration = metrics.Factory.NewHistogram(prometheus.HistogramOpts{
+		Name:    "kafka_consumer_processing_seconds",
+		Help:    "Time from fetching a message to its outcome, including retries.",
+		Buckets: prometheus.DefBuckets,
+	})
+	producerDuration = metrics.Factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "kafka_producer_publish_seconds",
+		Help:    "Publish latency by topic.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"topic"})
+	producerErrors = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "kafka_producer_errors_total",
+		Help: "Failed publishes by topic.",
+	}, []string{"topic"})
+)
@@ -0,0 +1,187 @@
+package kafka
+
+import (
+	"context"
+	"hash/fnv"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/neptship/wbtech-orders/internal/metrics"
+	"github.com/segmentio/kafka-go"
+)
+
+// runParallel is Run with a pool of workers. A message goes to the worker
+// picked by its key, so revisions of one order are still handled in offset
+// order while different orders proceed concurrently. Offsets are committed
+// through an offsetTracker, never past a message that is still in flight.
+func (c *Consumer) runParallel(ctx context.Context) {
+	tracker := newOffsetTracker()
+	slots := make(chan struct{}, c.maxPending)
+	queues := make([]chan trackedMessage, c.workers)
+	var wg sync.WaitGroup
+	for i := range queues {
+		queues[i] = make(chan trackedMessage, c.maxPending)
+		wg.Add(1)
+		go func(queue <-chan trackedMessage) {
+			defer wg.Done()
+			for tm := range queue {
+				c.work(ctx, tm, tracker)
+				<-slots
+				consumerInFlight.Add(-1)
+			}
+		}(queues[i])
+	}
+	defer func() {
+		for _, q := range queues {
+			close(q)
+		}
+		wg.Wait()
+	}()
+
+	for {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			slog.Info("kafka consumer stopping", "reason", ctx.Err())
+			return
+		}
+		m, ok := c.fetch(ctx)
+		if !ok {
+			<-slots
+			return
+		}
+		consumerInFlight.Add(1)
+		gen := tracker.start(m)
+		queues[workerFor(m.Key, len(queues))] <- trackedMessage{m, gen}
+	}
+}
+
+// work processes m and commits whatever the tracker allows afterwards. Once
+// ctx is done the remaining queued messages are left unfinished, so they are
+// redelivered after a restart.
+func (c *Consumer) work(ctx context.Context, tm trackedMessage, tracker *offsetTracker) {
+	m := tm.msg
+	if ctx.Err() != nil {
+		return
+	}
+	start := time.Now()
+	mctx, span := c.startMessage(ctx, m)
+	defer span.End()
+	if !c.process(mctx, m) {
+		slog.InfoContext(mctx, "kafka consumer stopping, offset left uncommitted", "partition", m.Partition, "offset", m.Offset)
+		return
+	}
+	metrics.ObserveSince(mctx, consumerDuration, start)
+	tracker.finish(m, tm.gen, func(upTo kafka.Message) { c.commit(mctx, upTo) })
+}
+
+func workerFor(key []byte, n int) int {
+	h := fnv.New32a()
+	_, _ = h.Write(key)
+	return int(h.Sum32() % uint32(n))
+}
+
+// trackedMessage is a fetched message with the tracker generation it was
+// started in.
+type trackedMessage struct {
+	msg kafka.Message
+	gen uint64
+}
+
+// offsetTracker knows which fetched messages of each partition are still in
+// flight, so that a partition's offset only advances past finished messages.
+type offsetTracker struct {
+	mu         sync.Mutex
+	gen        uint64
+	partitions map[partitionKey]*partitionOffsets
+	commits    map[partitionKey]*partitionCommit
+}
+
+type partitionKey struct {
+	topic     string
+	partition int
+}
+
+// partitionOffsets holds the unfinished messages of one partition in fetch
+// order, and which of them are done but still behind an unfinished one. gen
+// changes whenever the partition starts over after a rebalance.
+type partitionOffsets struct {
+	gen     uint64
+	pending []kafka.Message
+	done    map[int64]bool
+}
+
+// partitionCommit serializes the commits of one partition and remembers the
+// last committed offset, so that they never go backwards. It outlives
+// rebalances, unlike partitionOffsets.
+type partitionCommit struct {
+	mu        sync.Mutex
+	offset    int64
+	committed bool
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{
+		partitions: make(map[partitionKey]*partitionOffsets),
+		commits:    make(map[partitionKey]*partitionCommit),
+	}
+}
+
+// start records m as in flight and returns the generation to pass to finish.
+func (t *offsetTracker) start(m kafka.Message) uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	k := partitionKey{m.Topic, m.Partition}
+	p := t.partitions[k]
+	// After a rebalance the partition is fetched again from its committed
+	// offset; start over instead of waiting for messages fetched before.
+	if p == nil || len(p.pending) > 0 && m.Offset <= p.pending[len(p.pending)-1].Offset {
+		t.gen++
+		p = &partitionOffsets{gen: t.gen, done: make(map[int64]bool)}
+		t.partitions[k] = p
+	}
+	p.pending = append(p.pending, m)
+	return p.gen
+}
+
+// finish marks m, started in generation gen, as done. If that completes a run
+// of messages at the head of its partition, commit is called with the last of
+// them. Finishes of an earlier generation are ignored: their offsets may have
+// been fetched again and still be in flight. commit runs outside the tracker's
+// lock, so only commits of the same partition wait for each other.
+func (t *offsetTracker) finish(m kafka.Message, gen uint64, commit func(kafka.Message)) {
+	k := partitionKey{m.Topic, m.Partition}
+	t.mu.Lock()
+	p := t.partitions[k]
+	if p == nil || p.gen != gen {
+		t.mu.Unlock()
+		return
+	}
+	p.done[m.Offset] = true
+	n := 0
+	for n < len(p.pending) && p.done[p.pending[n].Offset] {
+		delete(p.done, p.pending[n].Offset)
+		n++
+	}
+	if n == 0 {
+		t.mu.Unlock()
+		return
+	}
+	last := p.pending[n-1]
+	p.pending = p.pending[n:]
+	pc := t.commits[k]
+	if pc == nil {
+		pc = &partitionCommit{}
+		t.commits[k] = pc
+	}
+	t.mu.Unlock()
+
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if pc.committed && last.Offset <= pc.offset {
+		return
+	}
+	commit(last)
+	pc.offset, pc.committed = last.Offset, true
+}
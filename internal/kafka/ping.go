@@ -0,0 +1,38 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+// ping succeeds as soon as one of brokers accepts a connection and answers an
+// ApiVersions request.
+func ping(ctx context.Context, brokers []string) error {
+	if len(brokers) == 0 {
+		return errors.New("no brokers configured")
+	}
+	var (
+		d    kafkago.Dialer
+		errs []error
+	)
+	for _, b := range brokers {
+		conn, err := d.DialContext(ctx, "tcp", b)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if deadline, ok := ctx.Deadline(); ok {
+			_ = conn.SetDeadline(deadline)
+		}
+		_, err = conn.ApiVersions()
+		_ = conn.Close()
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", b, err))
+	}
+	return fmt.Errorf("no reachable broker: %w", errors.Join(errs...))
+}
@@ -0,0 +1,26 @@
+package kafka
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPing_NoBrokers(t *testing.T) {
+	require.EqualError(t, ping(context.Background(), nil), "no brokers configured")
+}
+
+func TestPing_UnreachableBroker(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err = ping(ctx, []string{addr})
+	require.ErrorContains(t, err, "no reachable broker")
+}
@@ -4,18 +4,29 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"slices"
 	"time"
 
+	"github.com/neptship/wbtech-orders/internal/logging"
+	"github.com/neptship/wbtech-orders/internal/metrics"
 	kafkago "github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type ProducerConfig struct {
 	Brokers []string
 	Topic   string
+	// AutoCreateTopic lets the first publish create a missing topic. Only
+	// the dead-letter producer sets it, so that a misspelt KAFKA_TOPIC fails
+	// instead of silently creating a new topic.
+	AutoCreateTopic bool
 }
 
 type Producer struct {
-	w *kafkago.Writer
+	w       *kafkago.Writer
+	brokers []string
 }
 
 func NewProducer(cfg ProducerConfig) (*Producer, error) {
@@ -23,23 +34,150 @@ func NewProducer(cfg ProducerConfig) (*Producer, error) {
 		return nil, errors.New("invalid producer config: brokers and topic are required")
 	}
 	w := &kafkago.Writer{
-		Addr:     kafkago.TCP(cfg.Brokers...),
-		Topic:    cfg.Topic,
-		Balancer: &kafkago.LeastBytes{},
+		Addr:  kafkago.TCP(cfg.Brokers...),
+		Topic: cfg.Topic,
+		// Messages with the same key, the order_uid, go to the same partition,
+		// so one consumer sees every revision of an order in order.
+		Balancer: &kafkago.Hash{},
+		// Writes are synchronous, so the default of waiting up to a second
+		// for a batch to fill would delay every publish by that much.
+		BatchTimeout: 10 * time.Millisecond,
+
+		AllowAutoTopicCreation: cfg.AutoCreateTopic,
 	}
-	return &Producer{w: w}, nil
+	return &Producer{w: w, brokers: cfg.Brokers}, nil
 }
 
 func (p *Producer) Publish(ctx context.Context, key string, value []byte) error {
-	msg := kafkago.Message{
-		Key:   []byte(key),
-		Value: value,
-		Time:  time.Now(),
-	}
+	return p.PublishWithHeaders(ctx, key, value)
+}
+
+// HeaderRequestID carries the ID of the HTTP request that produced a message.
+const HeaderRequestID = "x-request-id"
+
+// PublishWithHeaders publishes value under key. The request ID in ctx, if any,
+// is added as HeaderRequestID unless headers already carry one, and the
+// publish span's trace context is injected so the consumer can continue the
+// trace.
+func (p *Producer) PublishWithHeaders(ctx context.Context, key string, value []byte, headers ...kafkago.Header) (err error) {
 	if ctx == nil {
 		ctx = context.Background()
 	}
-	return p.w.WriteMessages(ctx, msg)
+	ctx, span := tracer.Start(ctx, p.w.Topic+" publish", trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "kafka"),
+			attribute.String("messaging.destination.name", p.w.Topic),
+			attribute.String("messaging.kafka.message.key", key),
+		))
+	defer func() { endSpan(span, err) }()
+
+	headers = append([]kafkago.Header(nil), headers...)
+	if id := logging.RequestID(ctx); id != "" && headerValue(headers, HeaderRequestID) == "" {
+		headers = append(headers, kafkago.Header{Key: HeaderRequestID, Value: []byte(id)})
+	}
+	otel.GetTextMapPropagator().Inject(ctx, headerCarrier{&headers})
+	msg := kafkago.Message{
+		Key:     []byte(key),
+		Value:   value,
+		Headers: headers,
+		Time:    time.Now(),
+	}
+	start := time.Now()
+	err = p.w.WriteMessages(ctx, msg)
+	metrics.ObserveSince(ctx, producerDuration.WithLabelValues(p.w.Topic), start)
+	if err != nil {
+		producerErrors.WithLabelValues(p.w.Topic).Inc()
+		return &BrokerError{Op: "publish to " + p.w.Topic, Err: err}
+	}
+	return nil
+}
+
+// PublishBatch publishes msgs with a single write, so that a batch costs one
+// round trip instead of one per message. Each message gets its own publish
+// span, continuing the trace context already in its headers. It returns how
+// many messages, from the start, were written.
+func (p *Producer) PublishBatch(ctx context.Context, msgs []kafkago.Message) (int, error) {
+	if len(msgs) == 0 {
+		return 0, nil
+	}
+	msgs = append([]kafkago.Message(nil), msgs...)
+	spans := make([]trace.Span, len(msgs))
+	now := time.Now()
+	for i := range msgs {
+		m := &msgs[i]
+		m.Headers = append([]kafkago.Header(nil), m.Headers...)
+		mctx := otel.GetTextMapPropagator().Extract(ctx, headerCarrier{&m.Headers})
+		mctx, spans[i] = tracer.Start(mctx, p.w.Topic+" publish", trace.WithSpanKind(trace.SpanKindProducer),
+			trace.WithAttributes(
+				attribute.String("messaging.system", "kafka"),
+				attribute.String("messaging.destination.name", p.w.Topic),
+				attribute.String("messaging.kafka.message.key", string(m.Key)),
+			))
+		otel.GetTextMapPropagator().Inject(mctx, headerCarrier{&m.Headers})
+		if m.Time.IsZero() {
+			m.Time = now
+		}
+	}
+
+	start := time.Now()
+	n, err := p.write(ctx, msgs)
+	metrics.ObserveSince(ctx, producerDuration.WithLabelValues(p.w.Topic), start)
+	if err != nil {
+		producerErrors.WithLabelValues(p.w.Topic).Inc()
+		err = &BrokerError{Op: "publish to " + p.w.Topic, Err: err}
+	}
+	for i, span := range spans {
+		if i < n {
+			endSpan(span, nil)
+		} else {
+			endSpan(span, err)
+		}
+	}
+	return n, err
+}
+
+// write writes msgs and returns how many, from the start, were written. A
+// message over the writer's size limit fails the whole write before anything
+// is sent, so the messages ahead of it are then written on their own.
+func (p *Producer) write(ctx context.Context, msgs []kafkago.Message) (int, error) {
+	err := p.w.WriteMessages(ctx, msgs...)
+	if err == nil {
+		return len(msgs), nil
+	}
+	var tooLarge kafkago.MessageTooLargeError
+	if errors.As(err, &tooLarge) {
+		i := slices.IndexFunc(msgs, func(m kafkago.Message) bool { return sameValue(m, tooLarge.Message) })
+		if i <= 0 {
+			return 0, err
+		}
+		if n, werr := p.write(ctx, msgs[:i]); werr != nil {
+			return n, werr
+		}
+		return i, err
+	}
+	n := 0
+	var werrs kafkago.WriteErrors
+	if errors.As(err, &werrs) {
+		for n < len(werrs) && werrs[n] == nil {
+			n++
+		}
+	}
+	return n, err
+}
+
+// sameValue reports whether a and b share their value, which tells a message
+// apart from its copy in a MessageTooLargeError.
+func sameValue(a, b kafkago.Message) bool {
+	return len(a.Value) > 0 && len(a.Value) == len(b.Value) && &a.Value[0] == &b.Value[0]
+}
+
+func headerValue(headers []kafkago.Header, key string) string {
+	for _, h := range headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
 }
 
 func (p *Producer) PublishJSON(ctx context.Context, key string, v any) error {
@@ -50,6 +188,11 @@ func (p *Producer) PublishJSON(ctx context.Context, key string, v any) error {
 	return p.Publish(ctx, key, b)
 }
 
+// Ping reports whether a broker of the producer's cluster is reachable.
+func (p *Producer) Ping(ctx context.Context) error {
+	return ping(ctx, p.brokers)
+}
+
 func (p *Producer) Close() error {
 	return p.w.Close()
 }
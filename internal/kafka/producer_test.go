@@ -0,0 +1,45 @@
+package kafka
+
+import (
+	"errors"
+	"testing"
+
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewProducer_PartitionsByKey(t *testing.T) {
+	p, err := NewProducer(ProducerConfig{Brokers: []string{"localhost:9092"}, Topic: "orders"})
+	require.NoError(t, err)
+	defer p.Close()
+	require.IsType(t, &kafkago.Hash{}, p.w.Balancer)
+
+	partitions := []int{0, 1, 2, 3, 4, 5, 6, 7}
+	for _, key := range []string{"b563feb7b2b84b6test", "a1", "another-order"} {
+		m := kafkago.Message{Key: []byte(key)}
+		first := p.w.Balancer.Balance(m, partitions...)
+		for range 10 {
+			require.Equal(t, first, p.w.Balancer.Balance(m, partitions...), key)
+		}
+	}
+}
+
+func TestIsMessageRejected(t *testing.T) {
+	tooLarge := kafkago.MessageTooLargeError{Message: kafkago.Message{Value: []byte("x")}}
+	for _, tc := range []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"size limit", &BrokerError{Op: "publish", Err: kafkago.MessageSizeTooLarge}, true},
+		{"writer size limit", &BrokerError{Op: "publish", Err: tooLarge}, true},
+		{"first failed message of a batch", kafkago.WriteErrors{nil, kafkago.InvalidRecord, kafkago.LeaderNotAvailable}, true},
+		{"batch failed on the broker", kafkago.WriteErrors{nil, kafkago.LeaderNotAvailable, kafkago.MessageSizeTooLarge}, false},
+		{"broker unavailable", &BrokerError{Op: "publish", Err: kafkago.NotLeaderForPartition}, false},
+		{"network", &BrokerError{Op: "publish", Err: errors.New("dial tcp: connection refused")}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.want, IsMessageRejected(tc.err))
+		})
+	}
+}
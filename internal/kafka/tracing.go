@@ -0,0 +1,49 @@
+package kafka
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+var tracer = otel.Tracer("github.com/neptship/wbtech-orders/internal/kafka")
+
+// headerCarrier lets the OpenTelemetry propagator read and write trace
+// context in Kafka message headers.
+type headerCarrier struct {
+	headers *[]kafkago.Header
+}
+
+func (c headerCarrier) Get(key string) string {
+	return headerValue(*c.headers, key)
+}
+
+// Set replaces key, so a re-driven message carries the new context rather
+// than both.
+func (c headerCarrier) Set(key, value string) {
+	for i, h := range *c.headers {
+		if h.Key == key {
+			(*c.headers)[i].Value = []byte(value)
+			return
+		}
+	}
+	*c.headers = append(*c.headers, kafkago.Header{Key: key, Value: []byte(value)})
+}
+
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, len(*c.headers))
+	for i, h := range *c.headers {
+		keys[i] = h.Key
+	}
+	return keys
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
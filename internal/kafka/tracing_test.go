@@ -0,0 +1,61 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/neptship/wbtech-orders/internal/models"
+	"github.com/neptship/wbtech-orders/mocks"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestHeaderCarrier_SetReplaces(t *testing.T) {
+	headers := []kafka.Header{{Key: "traceparent", Value: []byte("old")}, {Key: "k", Value: []byte("v")}}
+	c := headerCarrier{&headers}
+	c.Set("traceparent", "new")
+	c.Set("tracestate", "x=1")
+
+	require.Equal(t, "new", c.Get("traceparent"))
+	require.Equal(t, []string{"traceparent", "k", "tracestate"}, c.Keys())
+}
+
+func TestConsumer_RunContinuesTraceFromHeaders(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	prevTP, prevProp := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer func() {
+		otel.SetTracerProvider(prevTP)
+		otel.SetTextMapPropagator(prevProp)
+	}()
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "POST /order_add")
+	var headers []kafka.Header
+	otel.GetTextMapPropagator().Inject(ctx, headerCarrier{&headers})
+	parent.End()
+
+	repo := mocks.NewOrderRepositoryMock(t)
+	r := newFakeReader(kafka.Message{Topic: "orders", Offset: 5, Value: []byte(validOrder), Headers: headers})
+	c := &Consumer{reader: r, topic: "orders", repo: repo, backoff: time.Millisecond, maxBackoff: time.Millisecond}
+	c.OnSaved = func(models.Order) {}
+	repo.EXPECT().Save(mock.Anything, mock.Anything).Return(nil).Once()
+
+	runUntilDrained(t, c, r)
+
+	names := map[string]bool{}
+	for _, s := range rec.Ended() {
+		require.Equal(t, parent.SpanContext().TraceID(), s.SpanContext().TraceID(), s.Name())
+		names[s.Name()] = true
+	}
+	for _, n := range []string{"orders process", "validate order", "OrderRepository.Save", "cache update"} {
+		require.True(t, names[n], n)
+	}
+}
@@ -0,0 +1,34 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/neptship/wbtech-orders/internal/logging"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew_AddsRequestIDFromContext(t *testing.T) {
+	var buf bytes.Buffer
+	l := logging.New(&buf, slog.LevelInfo)
+
+	ctx := logging.WithRequestID(context.Background(), "req-1")
+	l.With("component", "test").InfoContext(ctx, "order saved", "order_uid", "uid-1")
+	l.DebugContext(ctx, "dropped")
+
+	var rec map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &rec))
+	require.Equal(t, "order saved", rec["msg"])
+	require.Equal(t, "req-1", rec["request_id"])
+	require.Equal(t, "uid-1", rec["order_uid"])
+	require.Equal(t, "test", rec["component"])
+}
+
+func TestParseLevel(t *testing.T) {
+	require.Equal(t, slog.LevelDebug, logging.ParseLevel("DEBUG"))
+	require.Equal(t, slog.LevelWarn, logging.ParseLevel("warn"))
+	require.Equal(t, slog.LevelInfo, logging.ParseLevel("verbose"))
+}
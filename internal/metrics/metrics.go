@@ -0,0 +1,47 @@
+// Package metrics holds the Prometheus registry served on /metrics and the
+// helpers the instrumented packages share.
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Registry is the registry served on /metrics. It also carries the Go
+// runtime and process collectors.
+var Registry = prometheus.NewRegistry()
+
+// Factory registers new metrics with Registry.
+var Factory = promauto.With(Registry)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler serves Registry, in the OpenMetrics format when the scraper asks
+// for it, so that exemplars are exposed.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry, EnableOpenMetrics: true})
+}
+
+// ObserveSince records the seconds elapsed since start on o. If ctx carries a
+// sampled span, its trace ID is attached as an exemplar.
+func ObserveSince(ctx context.Context, o prometheus.Observer, start time.Time) {
+	v := time.Since(start).Seconds()
+	sc := trace.SpanContextFromContext(ctx)
+	if eo, ok := o.(prometheus.ExemplarObserver); ok && sc.IsSampled() {
+		eo.ObserveWithExemplar(v, prometheus.Labels{"trace_id": sc.TraceID().String()})
+		return
+	}
+	o.Observe(v)
+}
@@ -0,0 +1,61 @@
+package metrics_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neptship/wbtech-orders/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestObserveSince_AttachesTraceExemplar(t *testing.T) {
+	h := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test_seconds", Help: "Test latency."})
+	traceID := trace.TraceID{1, 2, 3}
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     trace.SpanID{4},
+		TraceFlags: trace.FlagsSampled,
+	}))
+
+	metrics.ObserveSince(ctx, h, time.Now())
+	metrics.ObserveSince(context.Background(), h, time.Now())
+
+	require.Equal(t, 1, testutil.CollectAndCount(h))
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(h)
+	mfs, err := reg.Gather()
+	require.NoError(t, err)
+	hist := mfs[0].GetMetric()[0].GetHistogram()
+	require.Equal(t, uint64(2), hist.GetSampleCount())
+	var exemplars []string
+	for _, b := range hist.GetBucket() {
+		if e := b.GetExemplar(); e != nil {
+			exemplars = append(exemplars, e.GetLabel()[0].GetValue())
+		}
+	}
+	require.Equal(t, []string{traceID.String()}, exemplars)
+}
+
+func TestHandler_EscapesLabelValues(t *testing.T) {
+	c := metrics.Factory.NewCounterVec(prometheus.CounterOpts{Name: "test_escaped_total", Help: "Escaping \\ test."}, []string{"route"})
+	c.WithLabelValues("/a\"b\\c\nd").Inc()
+
+	require.NoError(t, testutil.GatherAndCompare(metrics.Registry, strings.NewReader(`
+# HELP test_escaped_total Escaping \\ test.
+# TYPE test_escaped_total counter
+test_escaped_total{route="/a\"b\\c\nd"} 1
+`), "test_escaped_total"))
+
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), `test_escaped_total{route="/a\"b\\c\nd"} 1`)
+	require.Contains(t, rec.Body.String(), "go_goroutines")
+}
@@ -0,0 +1,357 @@
+// Package migrate applies the goose-format SQL migrations embedded in the
+// binary. Applied versions are tracked in goose's goose_db_version table, so
+// a database migrated with the goose CLI before can be taken over as is.
+package migrate
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lockKey is the session advisory lock this runner holds while it migrates, so
+// that replicas starting at once apply each migration only once. It is the key
+// goose's Provider uses with WithSessionLocker; the goose CLI takes no lock and
+// must not be run alongside.
+const lockKey int64 = 5887940537704921958
+
+const versionTable = "goose_db_version"
+
+// Migration is one parsed migration file.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      []string
+	Down    []string
+	// NoTx is set by "-- +goose NO TRANSACTION" for statements such as
+	// CREATE INDEX CONCURRENTLY that cannot run inside a transaction.
+	NoTx bool
+}
+
+// Status is a migration and when it was applied, zero if it is pending.
+type Status struct {
+	Migration Migration
+	AppliedAt time.Time
+}
+
+func (s Status) Applied() bool { return !s.AppliedAt.IsZero() }
+
+// Load parses every *.sql file of fsys, sorted by version. File names start
+// with the version, as in 000001_init_orders.sql.
+func Load(fsys fs.FS) ([]Migration, error) {
+	names, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Migration, 0, len(names))
+	seen := make(map[int64]string, len(names))
+	for _, name := range names {
+		b, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		m, err := Parse(name, string(b))
+		if err != nil {
+			return nil, err
+		}
+		if prev, ok := seen[m.Version]; ok {
+			return nil, fmt.Errorf("%s: version %d already used by %s", name, m.Version, prev)
+		}
+		seen[m.Version] = name
+		out = append(out, m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+// Parse splits a migration file into the statements of its "-- +goose Up"
+// and "-- +goose Down" sections. A statement ends with a line ending in a
+// semicolon, unless it is enclosed in StatementBegin/StatementEnd.
+func Parse(name, content string) (Migration, error) {
+	base := path.Base(name)
+	prefix, _, ok := strings.Cut(base, "_")
+	version, err := strconv.ParseInt(prefix, 10, 64)
+	if !ok || err != nil || version < 1 {
+		return Migration{}, fmt.Errorf("%s: file name must start with a positive version", name)
+	}
+	m := Migration{Version: version, Name: base}
+
+	var (
+		section *[]string
+		stmt    strings.Builder
+		block   bool
+	)
+	flush := func() {
+		if s := strings.TrimSpace(stmt.String()); s != "" && section != nil {
+			*section = append(*section, s)
+		}
+		stmt.Reset()
+	}
+	sc := bufio.NewScanner(strings.NewReader(content))
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		line := sc.Text()
+		if rest, ok := strings.CutPrefix(strings.TrimSpace(line), "-- +goose "); ok {
+			switch strings.TrimSpace(rest) {
+			case "Up":
+				flush()
+				section = &m.Up
+			case "Down":
+				flush()
+				section = &m.Down
+			case "StatementBegin":
+				flush()
+				block = true
+			case "StatementEnd":
+				block = false
+				flush()
+			case "NO TRANSACTION":
+				m.NoTx = true
+			default:
+				return Migration{}, fmt.Errorf("%s: unknown annotation %q", name, rest)
+			}
+			continue
+		}
+		if section == nil {
+			if strings.TrimSpace(line) != "" && !strings.HasPrefix(strings.TrimSpace(line), "--") {
+				return Migration{}, fmt.Errorf("%s: statement before -- +goose Up", name)
+			}
+			continue
+		}
+		stmt.WriteString(line)
+		stmt.WriteByte('\n')
+		if !block && strings.HasSuffix(strings.TrimSpace(line), ";") {
+			flush()
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return Migration{}, fmt.Errorf("%s: %w", name, err)
+	}
+	if block {
+		return Migration{}, fmt.Errorf("%s: StatementBegin without StatementEnd", name)
+	}
+	flush()
+	if m.Up == nil {
+		return Migration{}, fmt.Errorf("%s: no -- +goose Up section", name)
+	}
+	return m, nil
+}
+
+// Migrator runs migrations against a database.
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// New loads the migrations of fsys.
+func New(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	ms, err := Load(fsys)
+	if err != nil {
+		return nil, fmt.Errorf("load migrations: %w", err)
+	}
+	return &Migrator{db: db, migrations: ms}, nil
+}
+
+// Up applies every pending migration in version order and returns those it
+// applied.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+			if err := run(ctx, conn, mig, mig.Up,
+				`INSERT INTO `+versionTable+` (version_id, is_applied) VALUES ($1, true)`); err != nil {
+				return err
+			}
+			slog.InfoContext(ctx, "migration applied", "migration", mig.Name)
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down rolls back the most recently applied migration; ok is false if none
+// is applied. A migration without Down statements is refused rather than
+// marked as rolled back.
+func (m *Migrator) Down(ctx context.Context) (mig Migration, ok bool, err error) {
+	err = m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		var found bool
+		mig, found, err = lastApplied(m.migrations, applied)
+		if err != nil || !found {
+			return err
+		}
+		if err := run(ctx, conn, mig, mig.Down,
+			`DELETE FROM `+versionTable+` WHERE version_id = $1`); err != nil {
+			return err
+		}
+		slog.InfoContext(ctx, "migration rolled back", "migration", mig.Name)
+		ok = true
+		return nil
+	})
+	return mig, ok, err
+}
+
+// lastApplied returns the newest of ms that is applied, failing if it has
+// nothing to roll back with.
+func lastApplied(ms []Migration, applied map[int64]time.Time) (Migration, bool, error) {
+	for i := len(ms) - 1; i >= 0; i-- {
+		if _, ok := applied[ms[i].Version]; !ok {
+			continue
+		}
+		if len(ms[i].Down) == 0 {
+			return ms[i], false, fmt.Errorf("%s: no -- +goose Down statements, refusing to roll back", ms[i].Name)
+		}
+		return ms[i], true, nil
+	}
+	return Migration{}, false, nil
+}
+
+// Status lists every migration with the time it was applied.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var out []Status
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		out = make([]Status, len(m.migrations))
+		for i, mig := range m.migrations {
+			out[i] = Status{Migration: mig, AppliedAt: applied[mig.Version]}
+		}
+		return nil
+	})
+	return out, err
+}
+
+// locked runs fn on a single connection holding the migration advisory lock,
+// after making sure the version table exists.
+func (m *Migrator) locked(ctx context.Context, fn func(*sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("get connection: %w", err)
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockKey); err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+	defer func() {
+		// The lock must be released even if ctx is already done.
+		_, _ = conn.ExecContext(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock($1)`, lockKey)
+	}()
+	if err := ensureVersionTable(ctx, conn); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+// ensureVersionTable creates goose_db_version the way goose does, including
+// its initial version 0 row.
+func ensureVersionTable(ctx context.Context, conn *sql.Conn) error {
+	var exists bool
+	if err := conn.QueryRowContext(ctx, `SELECT to_regclass($1) IS NOT NULL`, versionTable).Scan(&exists); err != nil {
+		return fmt.Errorf("check version table: %w", err)
+	}
+	if exists {
+		return nil
+	}
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	if _, err := tx.ExecContext(ctx, `CREATE TABLE `+versionTable+` (
+            id SERIAL PRIMARY KEY,
+            version_id BIGINT NOT NULL,
+            is_applied BOOLEAN NOT NULL,
+            tstamp TIMESTAMP NULL DEFAULT now()
+        )`); err != nil {
+		return fmt.Errorf("create version table: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO `+versionTable+` (version_id, is_applied) VALUES (0, true)`); err != nil {
+		return fmt.Errorf("init version table: %w", err)
+	}
+	return tx.Commit()
+}
+
+// appliedVersions maps each applied version to when it was applied. As in
+// goose, the newest row of a version decides whether it is applied.
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version_id, is_applied, COALESCE(tstamp, now())
+        FROM `+versionTable+` WHERE version_id > 0 ORDER BY id DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("query versions: %w", err)
+	}
+	defer rows.Close()
+	seen := make(map[int64]bool)
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var (
+			version int64
+			ok      bool
+			at      time.Time
+		)
+		if err := rows.Scan(&version, &ok, &at); err != nil {
+			return nil, fmt.Errorf("scan version: %w", err)
+		}
+		if seen[version] {
+			continue
+		}
+		seen[version] = true
+		if ok {
+			applied[version] = at
+		}
+	}
+	return applied, rows.Err()
+}
+
+// run executes stmts and then record with the migration's version, all in one
+// transaction unless the migration opted out of it.
+func run(ctx context.Context, conn *sql.Conn, mig Migration, stmts []string, record string) error {
+	if mig.NoTx {
+		for _, s := range stmts {
+			if _, err := conn.ExecContext(ctx, s); err != nil {
+				return fmt.Errorf("%s: %w", mig.Name, err)
+			}
+		}
+		if _, err := conn.ExecContext(ctx, record, mig.Version); err != nil {
+			return fmt.Errorf("%s: record version: %w", mig.Name, err)
+		}
+		return nil
+	}
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	for _, s := range stmts {
+		if _, err := tx.ExecContext(ctx, s); err != nil {
+			return fmt.Errorf("%s: %w", mig.Name, err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, record, mig.Version); err != nil {
+		return fmt.Errorf("%s: record version: %w", mig.Name, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: commit: %w", mig.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package migrate
+
+import (
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/neptship/wbtech-orders/migrations"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse_SplitsSections(t *testing.T) {
+	m, err := Parse("000042_example.sql", `-- leading comment
+-- +goose Up
+CREATE TABLE a (
+    id INT
+);
+CREATE INDEX a_id ON a (id);
+
+-- +goose StatementBegin
+CREATE FUNCTION f() RETURNS INT AS $$
+BEGIN
+    RETURN 1;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose Down
+DROP TABLE a;
+`)
+	require.NoError(t, err)
+	require.Equal(t, int64(42), m.Version)
+	require.Equal(t, "000042_example.sql", m.Name)
+	require.False(t, m.NoTx)
+	require.Len(t, m.Up, 3)
+	require.Equal(t, "CREATE TABLE a (\n    id INT\n);", m.Up[0])
+	require.Contains(t, m.Up[2], "RETURN 1;\nEND;")
+	require.Equal(t, []string{"DROP TABLE a;"}, m.Down)
+}
+
+func TestParse_NoTransaction(t *testing.T) {
+	m, err := Parse("7_idx.sql", "-- +goose NO TRANSACTION\n-- +goose Up\nCREATE INDEX CONCURRENTLY i ON a (id);\n")
+	require.NoError(t, err)
+	require.True(t, m.NoTx)
+	require.Nil(t, m.Down)
+}
+
+func TestParse_Rejects(t *testing.T) {
+	for name, tc := range map[string]struct{ file, content string }{
+		"no version":     {"init.sql", "-- +goose Up\nSELECT 1;"},
+		"no up":          {"1_x.sql", "-- +goose Down\nSELECT 1;"},
+		"before up":      {"1_x.sql", "SELECT 1;\n-- +goose Up\nSELECT 1;"},
+		"unknown":        {"1_x.sql", "-- +goose Up\n-- +goose Sideways\nSELECT 1;"},
+		"unclosed block": {"1_x.sql", "-- +goose Up\n-- +goose StatementBegin\nSELECT 1;"},
+	} {
+		_, err := Parse(tc.file, tc.content)
+		require.Error(t, err, name)
+	}
+}
+
+func TestLoad_SortsAndRejectsDuplicateVersions(t *testing.T) {
+	ms, err := Load(fstest.MapFS{
+		"10_b.sql": {Data: []byte("-- +goose Up\nSELECT 2;")},
+		"9_a.sql":  {Data: []byte("-- +goose Up\nSELECT 1;")},
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(9), ms[0].Version)
+	require.Equal(t, int64(10), ms[1].Version)
+
+	_, err = Load(fstest.MapFS{
+		"1_a.sql":   {Data: []byte("-- +goose Up\nSELECT 1;")},
+		"001_b.sql": {Data: []byte("-- +goose Up\nSELECT 1;")},
+	})
+	require.Error(t, err)
+}
+
+func TestLoad_EmbeddedMigrations(t *testing.T) {
+	ms, err := Load(migrations.FS)
+	require.NoError(t, err)
+	require.NotEmpty(t, ms)
+	for i, m := range ms {
+		require.Equal(t, int64(i+1), m.Version, m.Name)
+		require.NotEmpty(t, m.Up, m.Name)
+		require.NotEmpty(t, m.Down, m.Name)
+	}
+}
+
+func TestLastApplied(t *testing.T) {
+	ms := []Migration{
+		{Version: 1, Name: "000001_a.sql", Up: []string{"SELECT 1;"}, Down: []string{"SELECT 1;"}},
+		{Version: 2, Name: "000002_b.sql", Up: []string{"SELECT 1;"}},
+		{Version: 3, Name: "000003_c.sql", Up: []string{"SELECT 1;"}, Down: []string{"SELECT 1;"}},
+	}
+
+	_, ok, err := lastApplied(ms, nil)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	mig, ok, err := lastApplied(ms, map[int64]time.Time{1: time.Now(), 3: time.Now()})
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, int64(3), mig.Version)
+
+	_, ok, err = lastApplied(ms, map[int64]time.Time{1: time.Now(), 2: time.Now()})
+	require.ErrorContains(t, err, "000002_b.sql")
+	require.False(t, ok)
+}
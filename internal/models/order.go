@@ -15,4 +15,5 @@ type Order struct {
 	SmID        int      `json:"sm_id"`
 	DateCreated string   `json:"date_created"`
 	OofShard    string   `json:"oof_shard"`
+	Revision    int64    `json:"revision,omitempty"`
 }
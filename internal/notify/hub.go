@@ -0,0 +1,51 @@
+// Package notify fans out in-process events to waiters keyed by an id.
+package notify
+
+import "sync"
+
+// Hub delivers a value published under a key to every subscriber waiting on
+// that key at the time. The zero value is ready to use.
+type Hub[T any] struct {
+	mu   sync.Mutex
+	subs map[string]map[chan T]struct{}
+}
+
+// Subscribe registers interest in key. The returned channel receives at most
+// one value; cancel must be called once the caller stops waiting.
+func (h *Hub[T]) Subscribe(key string) (<-chan T, func()) {
+	ch := make(chan T, 1)
+	h.mu.Lock()
+	if h.subs == nil {
+		h.subs = make(map[string]map[chan T]struct{})
+	}
+	if h.subs[key] == nil {
+		h.subs[key] = make(map[chan T]struct{})
+	}
+	h.subs[key][ch] = struct{}{}
+	h.mu.Unlock()
+	return ch, func() { h.remove(key, ch) }
+}
+
+// Publish hands v to the current subscribers of key, removing them, and
+// returns how many there were.
+func (h *Hub[T]) Publish(key string, v T) int {
+	h.mu.Lock()
+	subs := h.subs[key]
+	delete(h.subs, key)
+	h.mu.Unlock()
+	for ch := range subs {
+		ch <- v
+	}
+	return len(subs)
+}
+
+func (h *Hub[T]) remove(key string, ch chan T) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if subs := h.subs[key]; subs != nil {
+		delete(subs, ch)
+		if len(subs) == 0 {
+			delete(h.subs, key)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package notify_test
+
+import (
+	"testing"
+
+	"github.com/neptship/wbtech-orders/internal/notify"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHub_PublishReachesSubscribersOfKey(t *testing.T) {
+	var h notify.Hub[string]
+	a, cancelA := h.Subscribe("order-1")
+	defer cancelA()
+	b, cancelB := h.Subscribe("order-1")
+	defer cancelB()
+	other, cancelOther := h.Subscribe("order-2")
+	defer cancelOther()
+
+	require.Equal(t, 2, h.Publish("order-1", "saved"))
+	require.Equal(t, "saved", <-a)
+	require.Equal(t, "saved", <-b)
+	require.Empty(t, other)
+
+	require.Zero(t, h.Publish("order-1", "again"))
+}
+
+func TestHub_CancelledSubscriberIsSkipped(t *testing.T) {
+	var h notify.Hub[int]
+	_, cancel := h.Subscribe("k")
+	cancel()
+	require.Zero(t, h.Publish("k", 1))
+}
@@ -0,0 +1,26 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// IsTransient reports whether a failed write is worth retrying. Data and
+// constraint errors will fail the same way again, anything else (lost
+// connections, serialization failures, a restarting server, a schema that is
+// missing a migration) may not.
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code.Class() {
+		case "22", "23":
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,21 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsTransient(t *testing.T) {
+	require.False(t, IsTransient(nil))
+	require.False(t, IsTransient(context.Canceled))
+	require.False(t, IsTransient(&pq.Error{Code: "22001"}))
+	require.False(t, IsTransient(&pq.Error{Code: "23514"}))
+	require.True(t, IsTransient(&pq.Error{Code: "42P01"}), "undefined table means a missing migration")
+	require.True(t, IsTransient(&pq.Error{Code: "42703"}))
+	require.True(t, IsTransient(&pq.Error{Code: "40001"}))
+	require.True(t, IsTransient(errors.New("connection reset")))
+}
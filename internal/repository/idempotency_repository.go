@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// IdempotencyRecord is what is stored under an Idempotency-Key: the hash of
+// the request that first used it and, once that request finished, its
+// response. StatusCode is 0 while the first request is still in progress.
+type IdempotencyRecord struct {
+	RequestHash string
+	StatusCode  int
+	Header      http.Header
+	Body        []byte
+}
+
+func (r IdempotencyRecord) Completed() bool { return r.StatusCode != 0 }
+
+type IdempotencyRepository interface {
+	Claim(ctx context.Context, key, requestHash string, ttl time.Duration) (IdempotencyRecord, bool, error)
+	Complete(ctx context.Context, key string, rec IdempotencyRecord, ttl time.Duration) error
+	Release(ctx context.Context, key string) error
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+type PostgresIdempotencyRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresIdempotency(db *sql.DB) *PostgresIdempotencyRepository {
+	return &PostgresIdempotencyRepository{db: db}
+}
+
+// Claim reserves key for a request with requestHash for lease and reports
+// true. The lease only has to outlast the request: if its process dies before
+// Complete or Release, the key can be claimed again once the lease expired.
+// If the key is held by an unexpired record it reports false and returns that
+// record instead.
+func (r *PostgresIdempotencyRepository) Claim(ctx context.Context, key, requestHash string, lease time.Duration) (IdempotencyRecord, bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+            INSERT INTO idempotency_keys (key, request_hash, created_at, expires_at)
+            VALUES ($1, $2, now(), now() + $3 * interval '1 millisecond')
+            ON CONFLICT (key) DO UPDATE SET
+                request_hash=EXCLUDED.request_hash, status_code=NULL, headers='{}', body=NULL,
+                created_at=now(), expires_at=EXCLUDED.expires_at
+            WHERE idempotency_keys.expires_at <= now()
+        `, key, requestHash, lease.Milliseconds())
+	if err != nil {
+		return IdempotencyRecord{}, false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return IdempotencyRecord{}, false, err
+	}
+	if n == 1 {
+		return IdempotencyRecord{}, true, nil
+	}
+	var (
+		rec     IdempotencyRecord
+		status  sql.NullInt32
+		headers []byte
+	)
+	err = r.db.QueryRowContext(ctx, `
+            SELECT request_hash, status_code, headers, body FROM idempotency_keys WHERE key=$1
+        `, key).Scan(&rec.RequestHash, &status, &headers, &rec.Body)
+	if err != nil {
+		return IdempotencyRecord{}, false, err
+	}
+	rec.StatusCode = int(status.Int32)
+	if err := json.Unmarshal(headers, &rec.Header); err != nil {
+		return IdempotencyRecord{}, false, err
+	}
+	return rec, false, nil
+}
+
+// Complete stores the response of the request holding key and keeps it for
+// replay for ttl.
+func (r *PostgresIdempotencyRepository) Complete(ctx context.Context, key string, rec IdempotencyRecord, ttl time.Duration) error {
+	if rec.Header == nil {
+		rec.Header = http.Header{}
+	}
+	headers, err := json.Marshal(rec.Header)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `
+            UPDATE idempotency_keys
+            SET status_code=$2, headers=$3, body=$4, expires_at=now() + $5 * interval '1 millisecond'
+            WHERE key=$1
+        `, key, rec.StatusCode, headers, rec.Body, ttl.Milliseconds())
+	return err
+}
+
+// Release frees key after a request whose outcome must not be replayed.
+func (r *PostgresIdempotencyRepository) Release(ctx context.Context, key string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE key=$1 AND status_code IS NULL`, key)
+	return err
+}
+
+func (r *PostgresIdempotencyRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= now()`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
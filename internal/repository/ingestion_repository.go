@@ -0,0 +1,217 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	IngestionQueued   = "queued"
+	IngestionConsumed = "consumed"
+	IngestionSaved    = "saved"
+	IngestionRejected = "rejected"
+	IngestionSkipped  = "skipped"
+)
+
+// UnknownOrderUID is the Kafka key of a submission whose order_uid could not
+// be read.
+const UnknownOrderUID = "unknown"
+
+// Trackable reports whether orderUID names an order whose ingestion status
+// can be recorded.
+func Trackable(orderUID string) bool {
+	return orderUID != "" && orderUID != UnknownOrderUID
+}
+
+// Consumed is an order the consumer read from Kafka, for MarkConsumedBatch.
+type Consumed struct {
+	OrderUID  string
+	Partition int
+	Offset    int64
+}
+
+// Ingestion is the last known state of the most recent submission of an
+// order, from POST /order_add through the consumer.
+type Ingestion struct {
+	OrderUID   string     `json:"order_uid"`
+	Status     string     `json:"status"`
+	Reason     string     `json:"reason,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	Partition  *int       `json:"partition,omitempty"`
+	Offset     *int64     `json:"offset,omitempty"`
+	QueuedAt   *time.Time `json:"queued_at,omitempty"`
+	ConsumedAt *time.Time `json:"consumed_at,omitempty"`
+	SavedAt    *time.Time `json:"saved_at,omitempty"`
+	RejectedAt *time.Time `json:"rejected_at,omitempty"`
+	SkippedAt  *time.Time `json:"skipped_at,omitempty"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+type IngestionRepository interface {
+	MarkQueued(ctx context.Context, orderUID string) error
+	MarkConsumed(ctx context.Context, orderUID string, partition int, offset int64) error
+	MarkConsumedBatch(ctx context.Context, consumed []Consumed) error
+	MarkSaved(ctx context.Context, orderUID string) error
+	MarkRejected(ctx context.Context, orderUID, reason, msg string) error
+	MarkSkipped(ctx context.Context, orderUID, reason string) error
+	GetIngestion(ctx context.Context, orderUID string) (Ingestion, error)
+}
+
+type PostgresIngestionRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresIngestion(db *sql.DB) *PostgresIngestionRepository {
+	return &PostgresIngestionRepository{db: db}
+}
+
+const markQueuedQuery = `
+            INSERT INTO order_ingestion (order_uid, status, queued_at, updated_at)
+            VALUES ($1, 'queued', now(), now())
+            ON CONFLICT (order_uid) DO UPDATE SET
+                status='queued', reason=NULL, error=NULL,
+                kafka_partition=NULL, kafka_offset=NULL,
+                queued_at=now(), consumed_at=NULL, saved_at=NULL, rejected_at=NULL, skipped_at=NULL,
+                updated_at=now()
+        `
+
+// MarkQueued starts a new submission, discarding what was recorded for an
+// earlier one.
+func (r *PostgresIngestionRepository) MarkQueued(ctx context.Context, orderUID string) error {
+	_, err := r.db.ExecContext(ctx, markQueuedQuery, orderUID)
+	return err
+}
+
+func (r *PostgresIngestionRepository) MarkConsumed(ctx context.Context, orderUID string, partition int, offset int64) error {
+	_, err := r.db.ExecContext(ctx, `
+            INSERT INTO order_ingestion (order_uid, status, kafka_partition, kafka_offset, consumed_at, updated_at)
+            VALUES ($1, 'consumed', $2, $3, now(), now())
+            ON CONFLICT (order_uid) DO UPDATE SET
+                status='consumed', reason=NULL, error=NULL,
+                kafka_partition=EXCLUDED.kafka_partition, kafka_offset=EXCLUDED.kafka_offset,
+                consumed_at=now(), saved_at=NULL, rejected_at=NULL, skipped_at=NULL,
+                updated_at=now()
+        `, orderUID, partition, offset)
+	return err
+}
+
+// MarkConsumedBatch is MarkConsumed for several orders in one statement. Of
+// entries for the same order the last one wins.
+func (r *PostgresIngestionRepository) MarkConsumedBatch(ctx context.Context, consumed []Consumed) error {
+	last := make(map[string]int, len(consumed))
+	for i, c := range consumed {
+		last[c.OrderUID] = i
+	}
+	var (
+		uids       []string
+		partitions []int64
+		offsets    []int64
+	)
+	for i, c := range consumed {
+		if last[c.OrderUID] != i {
+			continue
+		}
+		uids = append(uids, c.OrderUID)
+		partitions = append(partitions, int64(c.Partition))
+		offsets = append(offsets, c.Offset)
+	}
+	if len(uids) == 0 {
+		return nil
+	}
+	_, err := r.db.ExecContext(ctx, `
+            INSERT INTO order_ingestion (order_uid, status, kafka_partition, kafka_offset, consumed_at, updated_at)
+            SELECT uid, 'consumed', partition, "offset", now(), now()
+            FROM unnest($1::text[], $2::int[], $3::bigint[]) AS c(uid, partition, "offset")
+            ON CONFLICT (order_uid) DO UPDATE SET
+                status='consumed', reason=NULL, error=NULL,
+                kafka_partition=EXCLUDED.kafka_partition, kafka_offset=EXCLUDED.kafka_offset,
+                consumed_at=now(), saved_at=NULL, rejected_at=NULL, skipped_at=NULL,
+                updated_at=now()
+        `, pq.Array(uids), pq.Array(partitions), pq.Array(offsets))
+	return err
+}
+
+func (r *PostgresIngestionRepository) MarkSaved(ctx context.Context, orderUID string) error {
+	_, err := r.db.ExecContext(ctx, `
+            INSERT INTO order_ingestion (order_uid, status, saved_at, updated_at)
+            VALUES ($1, 'saved', now(), now())
+            ON CONFLICT (order_uid) DO UPDATE SET
+                status='saved', reason=NULL, error=NULL, saved_at=now(), updated_at=now()
+        `, orderUID)
+	return err
+}
+
+func (r *PostgresIngestionRepository) MarkRejected(ctx context.Context, orderUID, reason, msg string) error {
+	_, err := r.db.ExecContext(ctx, `
+            INSERT INTO order_ingestion (order_uid, status, reason, error, rejected_at, updated_at)
+            VALUES ($1, 'rejected', $2, $3, now(), now())
+            ON CONFLICT (order_uid) DO UPDATE SET
+                status='rejected', reason=EXCLUDED.reason, error=EXCLUDED.error,
+                rejected_at=now(), updated_at=now()
+        `, orderUID, reason, msg)
+	return err
+}
+
+// MarkSkipped records that the consumer left the stored order untouched
+// because it was a duplicate or an older revision.
+func (r *PostgresIngestionRepository) MarkSkipped(ctx context.Context, orderUID, reason string) error {
+	_, err := r.db.ExecContext(ctx, `
+            INSERT INTO order_ingestion (order_uid, status, reason, skipped_at, updated_at)
+            VALUES ($1, 'skipped', $2, now(), now())
+            ON CONFLICT (order_uid) DO UPDATE SET
+                status='skipped', reason=EXCLUDED.reason, error=NULL,
+                skipped_at=now(), updated_at=now()
+        `, orderUID, reason)
+	return err
+}
+
+func (r *PostgresIngestionRepository) GetIngestion(ctx context.Context, orderUID string) (Ingestion, error) {
+	var (
+		in             Ingestion
+		reason, errMsg sql.NullString
+		partition      sql.NullInt32
+		offset         sql.NullInt64
+		queued         sql.NullTime
+		consumed       sql.NullTime
+		saved          sql.NullTime
+		rejected       sql.NullTime
+		skipped        sql.NullTime
+	)
+	err := r.db.QueryRowContext(ctx, `
+            SELECT order_uid, status, reason, error, kafka_partition, kafka_offset,
+                   queued_at, consumed_at, saved_at, rejected_at, skipped_at, updated_at
+            FROM order_ingestion WHERE order_uid=$1
+        `, orderUID).Scan(&in.OrderUID, &in.Status, &reason, &errMsg, &partition, &offset,
+		&queued, &consumed, &saved, &rejected, &skipped, &in.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Ingestion{}, ErrNotFound
+		}
+		return Ingestion{}, err
+	}
+	in.Reason, in.Error = reason.String, errMsg.String
+	if partition.Valid {
+		p := int(partition.Int32)
+		in.Partition = &p
+	}
+	if offset.Valid {
+		in.Offset = &offset.Int64
+	}
+	in.QueuedAt = nullTime(queued)
+	in.ConsumedAt = nullTime(consumed)
+	in.SavedAt = nullTime(saved)
+	in.RejectedAt = nullTime(rejected)
+	in.SkippedAt = nullTime(skipped)
+	return in, nil
+}
+
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
@@ -0,0 +1,323 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/neptship/wbtech-orders/internal/models"
+)
+
+// NewPostgresNormalized returns a repository for the normalized layout: the
+// JSONB columns are still written, so that switching back stays possible,
+// but delivery, payment and items are read from their own tables.
+func NewPostgresNormalized(db *sql.DB) *PostgresOrderRepository {
+	return &PostgresOrderRepository{db: db, normalized: true}
+}
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+const (
+	deliveryColumns = `order_uid, name, phone, zip, city, address, region, email`
+	paymentColumns  = `order_uid, transaction, request_id, currency, provider, amount, payment_dt,
+        bank, delivery_cost, goods_total, custom_fee`
+	itemColumns = `order_uid, position, chrt_id, track_number, price, rid, name, sale, size,
+        total_price, nm_id, brand, status`
+)
+
+// writeDetails replaces the deliveries, payments and order_items rows of the
+// orders in chunk that were written.
+func writeDetails(ctx context.Context, tx execer, chunk []models.Order, written map[string]bool) error {
+	var (
+		uids       []string
+		deliveries [][]any
+		payments   [][]any
+		items      [][]any
+	)
+	for _, o := range chunk {
+		if !written[o.OrderUID] {
+			continue
+		}
+		uids = append(uids, o.OrderUID)
+		d, p := o.Delivery, o.Payment
+		deliveries = append(deliveries, []any{o.OrderUID, d.Name, d.Phone, d.Zip, d.City, d.Address, d.Region, d.Email})
+		payments = append(payments, []any{o.OrderUID, p.Transaction, p.RequestID, p.Currency, p.Provider,
+			p.Amount, p.PaymentDT, p.Bank, p.DeliveryCost, p.GoodsTotal, p.CustomFee})
+		for i, it := range o.Items {
+			items = append(items, []any{o.OrderUID, i, it.ChrtID, it.TrackNumber, it.Price, it.RID, it.Name,
+				it.Sale, it.Size, it.TotalPrice, it.NmID, it.Brand, it.Status})
+		}
+	}
+	if len(uids) == 0 {
+		return nil
+	}
+	for _, table := range []string{"deliveries", "payments", "order_items"} {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE order_uid = ANY($1)`, pq.Array(uids)); err != nil {
+			return fmt.Errorf("delete %s: %w", table, err)
+		}
+	}
+	if err := insertRows(ctx, tx, "deliveries", deliveryColumns, deliveries); err != nil {
+		return err
+	}
+	if err := insertRows(ctx, tx, "payments", paymentColumns, payments); err != nil {
+		return err
+	}
+	return insertRows(ctx, tx, "order_items", itemColumns, items)
+}
+
+// insertRows inserts rows into table with multi-row INSERTs of at most
+// maxUpsertRows rows each.
+func insertRows(ctx context.Context, tx execer, table, columns string, rows [][]any) error {
+	for len(rows) > 0 {
+		chunk := rows[:min(len(rows), maxUpsertRows)]
+		rows = rows[len(chunk):]
+		q, args := buildInsert(table, columns, chunk)
+		if _, err := tx.ExecContext(ctx, q, args...); err != nil {
+			return fmt.Errorf("insert %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+func buildInsert(table, columns string, rows [][]any) (string, []any) {
+	var b strings.Builder
+	args := make([]any, 0, len(rows)*len(rows[0]))
+	b.WriteString(`INSERT INTO ` + table + ` (` + columns + `) VALUES `)
+	for i, row := range rows {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString("(")
+		for j, v := range row {
+			if j > 0 {
+				b.WriteString(",")
+			}
+			args = append(args, v)
+			b.WriteString("$" + strconv.Itoa(len(args)))
+		}
+		b.WriteString(")")
+	}
+	return b.String(), args
+}
+
+// loadDetails fills delivery, payment and items of orders from their tables.
+// Orders that have no rows there yet, because they predate the layout and
+// were not backfilled, keep what was read from the JSONB columns.
+func loadDetails(ctx context.Context, q queryer, orders []models.Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+	index := make(map[string]int, len(orders))
+	uids := make([]string, len(orders))
+	for i, o := range orders {
+		index[o.OrderUID] = i
+		uids[i] = o.OrderUID
+	}
+
+	rows, err := q.QueryContext(ctx, `SELECT `+deliveryColumns+` FROM deliveries WHERE order_uid = ANY($1)`, pq.Array(uids))
+	if err != nil {
+		return fmt.Errorf("query deliveries: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			uid string
+			d   models.Delivery
+		)
+		if err := rows.Scan(&uid, &d.Name, &d.Phone, &d.Zip, &d.City, &d.Address, &d.Region, &d.Email); err != nil {
+			return fmt.Errorf("scan delivery: %w", err)
+		}
+		orders[index[uid]].Delivery = d
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = q.QueryContext(ctx, `SELECT `+paymentColumns+` FROM payments WHERE order_uid = ANY($1)`, pq.Array(uids))
+	if err != nil {
+		return fmt.Errorf("query payments: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			uid string
+			p   models.Payment
+		)
+		if err := rows.Scan(&uid, &p.Transaction, &p.RequestID, &p.Currency, &p.Provider, &p.Amount,
+			&p.PaymentDT, &p.Bank, &p.DeliveryCost, &p.GoodsTotal, &p.CustomFee); err != nil {
+			return fmt.Errorf("scan payment: %w", err)
+		}
+		orders[index[uid]].Payment = p
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = q.QueryContext(ctx, `SELECT `+itemColumns+` FROM order_items WHERE order_uid = ANY($1)
+        ORDER BY order_uid, position`, pq.Array(uids))
+	if err != nil {
+		return fmt.Errorf("query order_items: %w", err)
+	}
+	defer rows.Close()
+	loaded := make(map[string]bool, len(orders))
+	for rows.Next() {
+		var (
+			uid string
+			pos int
+			it  models.Item
+		)
+		if err := rows.Scan(&uid, &pos, &it.ChrtID, &it.TrackNumber, &it.Price, &it.RID, &it.Name,
+			&it.Sale, &it.Size, &it.TotalPrice, &it.NmID, &it.Brand, &it.Status); err != nil {
+			return fmt.Errorf("scan item: %w", err)
+		}
+		o := &orders[index[uid]]
+		if !loaded[uid] {
+			loaded[uid] = true
+			o.Items = o.Items[:0:0]
+		}
+		o.Items = append(o.Items, it)
+	}
+	return rows.Err()
+}
+
+// BackfillStats reports the outcome of BackfillNormalized.
+type BackfillStats struct {
+	Migrated int
+	Failed   int
+}
+
+// BackfillNormalized copies delivery, payment and items of every order that
+// has no deliveries row yet from its JSONB columns into the normalized
+// tables, batch orders per transaction. An order whose data violates the
+// constraints of the new tables is logged, counted as failed and skipped; it
+// keeps being served from JSONB.
+func BackfillNormalized(ctx context.Context, db *sql.DB, batch int) (BackfillStats, error) {
+	var (
+		stats BackfillStats
+		after string
+	)
+	for {
+		uids, err := unmigratedUIDs(ctx, db, after, batch)
+		if err != nil {
+			return stats, err
+		}
+		if len(uids) == 0 {
+			return stats, nil
+		}
+		after = uids[len(uids)-1]
+		n, err := backfillTx(ctx, db, uids)
+		if err == nil {
+			stats.Migrated += n
+			continue
+		}
+		if IsTransient(err) {
+			return stats, err
+		}
+		for _, uid := range uids {
+			n, err := backfillTx(ctx, db, []string{uid})
+			if err != nil {
+				if IsTransient(err) {
+					return stats, err
+				}
+				slog.WarnContext(ctx, "backfill: order not migrated", "order_uid", uid, "err", err)
+				stats.Failed++
+				continue
+			}
+			stats.Migrated += n
+		}
+	}
+}
+
+func unmigratedUIDs(ctx context.Context, db *sql.DB, after string, limit int) ([]string, error) {
+	rows, err := db.QueryContext(ctx, `SELECT order_uid FROM orders
+        WHERE order_uid > $1 AND NOT EXISTS (SELECT 1 FROM deliveries d WHERE d.order_uid = orders.order_uid)
+        ORDER BY order_uid LIMIT $2`, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query orders: %w", err)
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var uid string
+		if err := rows.Scan(&uid); err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		out = append(out, uid)
+	}
+	return out, rows.Err()
+}
+
+// backfillTx migrates those of uids that still have no deliveries row and
+// returns how many. The orders are read under a row lock, which the consumer
+// also takes when it writes an order, so what is copied is the latest
+// revision and a write of the normalized rows cannot slip in between.
+func backfillTx(ctx context.Context, db *sql.DB, uids []string) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	rows, err := tx.QueryContext(ctx, `SELECT `+orderColumns+` FROM orders
+        WHERE order_uid = ANY($1) ORDER BY order_uid FOR UPDATE`, pq.Array(uids))
+	if err != nil {
+		return 0, fmt.Errorf("lock orders: %w", err)
+	}
+	var orders []models.Order
+	for rows.Next() {
+		o, err := scanOrder(rows)
+		if err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("scan: %w", err)
+		}
+		orders = append(orders, o)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	// Checked only now, holding the locks, so that this statement sees details
+	// written by a transaction that committed while we waited for them.
+	rows, err = tx.QueryContext(ctx, `SELECT order_uid FROM deliveries WHERE order_uid = ANY($1)`, pq.Array(uids))
+	if err != nil {
+		return 0, fmt.Errorf("query deliveries: %w", err)
+	}
+	migrated := make(map[string]bool)
+	for rows.Next() {
+		var uid string
+		if err := rows.Scan(&uid); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("scan: %w", err)
+		}
+		migrated[uid] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	written := make(map[string]bool, len(orders))
+	for _, o := range orders {
+		if !migrated[o.OrderUID] {
+			written[o.OrderUID] = true
+		}
+	}
+	if err := writeDetails(ctx, tx, orders, written); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(written), nil
+}
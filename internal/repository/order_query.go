@@ -0,0 +1,256 @@
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/neptship/wbtech-orders/internal/models"
+)
+
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 500
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// OrderFilter selects orders for List. Zero fields are ignored; CreatedFrom
+// is inclusive and CreatedTo exclusive.
+type OrderFilter struct {
+	CustomerID      string
+	TrackNumber     string
+	DeliveryService string
+	CreatedFrom     time.Time
+	CreatedTo       time.Time
+	Currency        string
+	Provider        string
+	Brand           string
+	NmID            int
+	Cursor          string
+	Limit           int
+}
+
+type OrderPage struct {
+	Orders     []models.Order `json:"orders"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+// cursor is the keyset position after the last order of a page, in the
+// (date_created DESC, order_uid DESC) listing order.
+type cursor struct {
+	DateCreated string `json:"d"`
+	OrderUID    string `json:"u"`
+}
+
+func encodeCursor(o models.Order) string {
+	b, _ := json.Marshal(cursor{DateCreated: o.DateCreated, OrderUID: o.OrderUID})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(b, &c); err != nil || c.OrderUID == "" {
+		return c, ErrInvalidCursor
+	}
+	if _, err := time.Parse(time.RFC3339Nano, c.DateCreated); err != nil {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+type whereBuilder struct {
+	conds []string
+	args  []any
+}
+
+func (w *whereBuilder) add(cond string, args ...any) {
+	for _, a := range args {
+		w.args = append(w.args, a)
+		cond = strings.Replace(cond, "?", fmt.Sprintf("$%d", len(w.args)), 1)
+	}
+	w.conds = append(w.conds, cond)
+}
+
+func (w *whereBuilder) sql() string {
+	if len(w.conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(w.conds, " AND ")
+}
+
+func itemContains(field string, v any) string {
+	b, _ := json.Marshal([]map[string]any{{field: v}})
+	return string(b)
+}
+
+func pageSize(limit int) int {
+	if limit <= 0 {
+		return DefaultPageSize
+	}
+	if limit > MaxPageSize {
+		return MaxPageSize
+	}
+	return limit
+}
+
+// buildListQuery selects one order more than limit to tell whether another
+// page follows. Payment and item filters go against the JSONB columns or,
+// when normalized is set, the payments and order_items tables.
+func buildListQuery(f OrderFilter, limit int, normalized bool) (string, []any, error) {
+	w := &whereBuilder{}
+	w.add("date_created IS NOT NULL")
+	if f.CustomerID != "" {
+		w.add("customer_id = ?", f.CustomerID)
+	}
+	if f.TrackNumber != "" {
+		w.add("track_number = ?", f.TrackNumber)
+	}
+	if f.DeliveryService != "" {
+		w.add("delivery_service = ?", f.DeliveryService)
+	}
+	if !f.CreatedFrom.IsZero() {
+		w.add("date_created >= ?", f.CreatedFrom)
+	}
+	if !f.CreatedTo.IsZero() {
+		w.add("date_created < ?", f.CreatedTo)
+	}
+	switch {
+	case normalized:
+		if f.Currency != "" {
+			w.add("EXISTS (SELECT 1 FROM payments p WHERE p.order_uid = orders.order_uid AND p.currency = ?)", f.Currency)
+		}
+		if f.Provider != "" {
+			w.add("EXISTS (SELECT 1 FROM payments p WHERE p.order_uid = orders.order_uid AND p.provider = ?)", f.Provider)
+		}
+		if f.Brand != "" {
+			w.add("EXISTS (SELECT 1 FROM order_items i WHERE i.order_uid = orders.order_uid AND i.brand = ?)", f.Brand)
+		}
+		if f.NmID != 0 {
+			w.add("EXISTS (SELECT 1 FROM order_items i WHERE i.order_uid = orders.order_uid AND i.nm_id = ?)", f.NmID)
+		}
+	default:
+		if f.Currency != "" {
+			w.add("payment->>'currency' = ?", f.Currency)
+		}
+		if f.Provider != "" {
+			w.add("payment->>'provider' = ?", f.Provider)
+		}
+		if f.Brand != "" {
+			w.add("items @> ?::jsonb", itemContains("brand", f.Brand))
+		}
+		if f.NmID != 0 {
+			w.add("items @> ?::jsonb", itemContains("nm_id", f.NmID))
+		}
+	}
+	if f.Cursor != "" {
+		c, err := decodeCursor(f.Cursor)
+		if err != nil {
+			return "", nil, err
+		}
+		w.add("(date_created, order_uid) < (?::timestamptz, ?)", c.DateCreated, c.OrderUID)
+	}
+	w.args = append(w.args, limit+1)
+	q := `SELECT ` + orderColumns + ` FROM orders` + w.sql() +
+		fmt.Sprintf(` ORDER BY date_created DESC, order_uid DESC LIMIT $%d`, len(w.args))
+	return q, w.args, nil
+}
+
+// List returns one page of orders matching f, newest first.
+func (r *PostgresOrderRepository) List(ctx context.Context, f OrderFilter) (OrderPage, error) {
+	limit := pageSize(f.Limit)
+	q, args, err := buildListQuery(f, limit, r.normalized)
+	if err != nil {
+		return OrderPage{}, err
+	}
+	orders, err := r.queryOrders(ctx, q, args...)
+	if err != nil {
+		return OrderPage{}, fmt.Errorf("list orders: %w", err)
+	}
+	page := OrderPage{Orders: orders}
+	if page.Orders == nil {
+		page.Orders = []models.Order{}
+	}
+	if len(page.Orders) > limit {
+		page.Orders = page.Orders[:limit]
+		page.NextCursor = encodeCursor(page.Orders[limit-1])
+	}
+	return page, nil
+}
+
+func (r *PostgresOrderRepository) queryOrders(ctx context.Context, q string, args ...any) ([]models.Order, error) {
+	rows, err := r.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []models.Order
+	for rows.Next() {
+		o, err := scanOrder(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		out = append(out, o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if r.normalized {
+		if err := loadDetails(ctx, r.db, out); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// FindByTrack returns the orders with the given track number, newest first.
+func (r *PostgresOrderRepository) FindByTrack(ctx context.Context, track string) ([]models.Order, error) {
+	out, err := r.queryOrders(ctx, `SELECT `+orderColumns+` FROM orders WHERE track_number = $1
+        ORDER BY date_created DESC NULLS LAST, order_uid DESC LIMIT $2`, track, MaxPageSize)
+	if err != nil {
+		return nil, fmt.Errorf("find by track: %w", err)
+	}
+	return out, nil
+}
+
+// FindByRID returns the order containing the item with the given rid.
+func (r *PostgresOrderRepository) FindByRID(ctx context.Context, rid string) (models.Order, error) {
+	cond := `jsonb_path_query_array(items, '$[*].rid') @> jsonb_build_array($1::text)`
+	if r.normalized {
+		cond = `order_uid IN (SELECT order_uid FROM order_items WHERE rid = $1)`
+	}
+	out, err := r.queryOrders(ctx, `SELECT `+orderColumns+` FROM orders
+        WHERE `+cond+`
+        ORDER BY date_created DESC NULLS LAST LIMIT 1`, rid)
+	if err != nil {
+		return models.Order{}, fmt.Errorf("find by rid: %w", err)
+	}
+	if len(out) == 0 {
+		return models.Order{}, ErrNotFound
+	}
+	return out[0], nil
+}
+
+// FindByChrtID returns the orders containing an item with the given chrt_id,
+// newest first.
+func (r *PostgresOrderRepository) FindByChrtID(ctx context.Context, chrtID int) ([]models.Order, error) {
+	cond := `jsonb_path_query_array(items, '$[*].chrt_id') @> jsonb_build_array($1::int)`
+	if r.normalized {
+		cond = `order_uid IN (SELECT order_uid FROM order_items WHERE chrt_id = $1)`
+	}
+	out, err := r.queryOrders(ctx, `SELECT `+orderColumns+` FROM orders
+        WHERE `+cond+`
+        ORDER BY date_created DESC NULLS LAST, order_uid DESC LIMIT $2`, chrtID, MaxPageSize)
+	if err != nil {
+		return nil, fmt.Errorf("find by chrt_id: %w", err)
+	}
+	return out, nil
+}
@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/neptship/wbtech-orders/internal/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildListQuery_Filters(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	q, args, err := buildListQuery(OrderFilter{
+		CustomerID:  "test",
+		CreatedFrom: from,
+		Currency:    "USD",
+		Brand:       "Vivienne Sabo",
+		NmID:        2389212,
+	}, 10, false)
+	require.NoError(t, err)
+
+	require.Contains(t, q, "WHERE date_created IS NOT NULL AND customer_id = $1 AND date_created >= $2 AND payment->>'currency' = $3 AND items @> $4::jsonb AND items @> $5::jsonb")
+	require.Contains(t, q, "ORDER BY date_created DESC, order_uid DESC LIMIT $6")
+	require.Equal(t, []any{"test", from, "USD", `[{"brand":"Vivienne Sabo"}]`, `[{"nm_id":2389212}]`, 11}, args)
+}
+
+func TestBuildListQuery_NormalizedFilters(t *testing.T) {
+	q, args, err := buildListQuery(OrderFilter{Currency: "USD", NmID: 2389212}, 10, true)
+	require.NoError(t, err)
+
+	require.Contains(t, q, "EXISTS (SELECT 1 FROM payments p WHERE p.order_uid = orders.order_uid AND p.currency = $1)")
+	require.Contains(t, q, "EXISTS (SELECT 1 FROM order_items i WHERE i.order_uid = orders.order_uid AND i.nm_id = $2)")
+	require.NotContains(t, q, "jsonb")
+	require.Equal(t, []any{"USD", 2389212, 11}, args)
+}
+
+func TestBuildListQuery_Cursor(t *testing.T) {
+	c := encodeCursor(models.Order{OrderUID: "b563feb7b2b84b6test", DateCreated: "2021-11-26T06:22:19Z"})
+
+	q, args, err := buildListQuery(OrderFilter{Cursor: c}, 10, false)
+	require.NoError(t, err)
+	require.Contains(t, q, "(date_created, order_uid) < ($1::timestamptz, $2)")
+	require.Equal(t, []any{"2021-11-26T06:22:19Z", "b563feb7b2b84b6test", 11}, args)
+
+	_, _, err = buildListQuery(OrderFilter{Cursor: "not-a-cursor"}, 10, false)
+	require.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestPageSize(t *testing.T) {
+	require.Equal(t, DefaultPageSize, pageSize(0))
+	require.Equal(t, 7, pageSize(7))
+	require.Equal(t, MaxPageSize, pageSize(MaxPageSize+1))
+}
@@ -2,50 +2,274 @@ package repository
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/lib/pq"
 	"github.com/neptship/wbtech-orders/internal/models"
 )
 
 type OrderRepository interface {
 	Save(ctx context.Context, o models.Order) error
+	SaveBatch(ctx context.Context, orders []models.Order) ([]error, error)
 	Get(ctx context.Context, id string) (models.Order, error)
+	StreamRecent(ctx context.Context, limit int, fn func(models.Order) error) error
+	List(ctx context.Context, f OrderFilter) (OrderPage, error)
+	FindByTrack(ctx context.Context, track string) ([]models.Order, error)
+	FindByRID(ctx context.Context, rid string) (models.Order, error)
+	FindByChrtID(ctx context.Context, chrtID int) ([]models.Order, error)
 }
 
-var ErrNotFound = errors.New("order not found")
+var (
+	ErrNotFound = errors.New("order not found")
+	// ErrDuplicate means the stored order is identical to the one being saved.
+	ErrDuplicate = errors.New("order already stored with identical content")
+	// ErrStale means a newer revision of the order is already stored.
+	ErrStale = errors.New("newer revision of the order already stored")
+)
 
+// PostgresOrderRepository stores orders in the orders table, with delivery,
+// payment and items as JSONB. In the normalized layout they are also written
+// to the deliveries, payments and order_items tables and read from there.
 type PostgresOrderRepository struct {
-	db *sql.DB
+	db         *sql.DB
+	normalized bool
 }
 
 func NewPostgres(db *sql.DB) *PostgresOrderRepository { return &PostgresOrderRepository{db: db} }
 
+// Save stores o unless that would be a no-op or a step back, which it reports
+// as ErrDuplicate or ErrStale.
 func (r *PostgresOrderRepository) Save(ctx context.Context, o models.Order) error {
+	skipped, err := r.SaveBatch(ctx, []models.Order{o})
+	if err != nil {
+		return err
+	}
+	return skipped[0]
+}
+
+// maxUpsertRows keeps a single INSERT well below the 65535 bind parameter
+// limit of the Postgres protocol.
+const maxUpsertRows = 1000
+
+// SaveBatch upserts orders in one transaction using multi-row INSERTs. The
+// returned slice has an entry per order: nil if it was stored, ErrDuplicate or
+// ErrStale if it was skipped, either because of what is already stored or
+// because the batch holds a newer revision of the same order.
+func (r *PostgresOrderRepository) SaveBatch(ctx context.Context, orders []models.Order) ([]error, error) {
+	skipped := make([]error, len(orders))
+	latest := latestByUID(orders)
+	hashes := make(map[string]string, len(latest))
+	for _, i := range latest {
+		h, err := contentHash(orders[i])
+		if err != nil {
+			return nil, fmt.Errorf("order %s: %w", orders[i].OrderUID, err)
+		}
+		hashes[orders[i].OrderUID] = h
+	}
+	for i, o := range orders {
+		if latest[o.OrderUID] == i {
+			continue
+		}
+		h, err := contentHash(o)
+		if err != nil {
+			return nil, fmt.Errorf("order %s: %w", o.OrderUID, err)
+		}
+		if h == hashes[o.OrderUID] {
+			skipped[i] = ErrDuplicate
+		} else {
+			skipped[i] = ErrStale
+		}
+	}
+	if len(latest) == 0 {
+		return skipped, nil
+	}
+
 	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("begin tx: %w", err)
+		return nil, fmt.Errorf("begin tx: %w", err)
 	}
 	defer func() { _ = tx.Rollback() }()
-	deliveryJSON, err := json.Marshal(o.Delivery)
+	pending := make([]models.Order, 0, len(latest))
+	for i, o := range orders {
+		if latest[o.OrderUID] == i {
+			pending = append(pending, o)
+		}
+	}
+	written := make(map[string]bool, len(pending))
+	for len(pending) > 0 {
+		chunk := pending[:min(len(pending), maxUpsertRows)]
+		pending = pending[len(chunk):]
+		if err := upsert(ctx, tx, chunk, hashes, written); err != nil {
+			return nil, err
+		}
+		if r.normalized {
+			if err := writeDetails(ctx, tx, chunk, written); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var notWritten []string
+	for uid := range latest {
+		if !written[uid] {
+			notWritten = append(notWritten, uid)
+		}
+	}
+	if len(notWritten) > 0 {
+		stored, err := storedHashes(ctx, tx, notWritten)
+		if err != nil {
+			return nil, err
+		}
+		for uid, i := range latest {
+			switch {
+			case written[uid]:
+			case stored[uid] == hashes[uid]:
+				skipped[i] = ErrDuplicate
+			default:
+				skipped[i] = ErrStale
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return skipped, nil
+}
+
+// upsert writes chunk and records in written the orders that were inserted
+// or updated.
+func upsert(ctx context.Context, tx *sql.Tx, chunk []models.Order, hashes map[string]string, written map[string]bool) error {
+	args := make([]any, 0, len(chunk)*orderColumnCount)
+	for _, o := range chunk {
+		a, err := orderArgs(o, hashes[o.OrderUID])
+		if err != nil {
+			return fmt.Errorf("order %s: %w", o.OrderUID, err)
+		}
+		args = append(args, a...)
+	}
+	rows, err := tx.QueryContext(ctx, buildUpsert(len(chunk)), args...)
 	if err != nil {
 		return err
 	}
+	defer rows.Close()
+	for rows.Next() {
+		var uid string
+		if err := rows.Scan(&uid); err != nil {
+			return err
+		}
+		written[uid] = true
+	}
+	return rows.Err()
+}
+
+func storedHashes(ctx context.Context, tx *sql.Tx, uids []string) (map[string]string, error) {
+	rows, err := tx.QueryContext(ctx,
+		`SELECT order_uid, COALESCE(content_hash, '') FROM orders WHERE order_uid = ANY($1)`, pq.Array(uids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make(map[string]string, len(uids))
+	for rows.Next() {
+		var uid, h string
+		if err := rows.Scan(&uid, &h); err != nil {
+			return nil, err
+		}
+		out[uid] = h
+	}
+	return out, rows.Err()
+}
+
+// latestByUID maps each order_uid in orders to the index of its newest
+// revision; among equal revisions the last occurrence wins, as it would with
+// sequential saves.
+func latestByUID(orders []models.Order) map[string]int {
+	latest := make(map[string]int, len(orders))
+	for i, o := range orders {
+		if j, ok := latest[o.OrderUID]; ok && olderRevision(o, orders[j]) {
+			continue
+		}
+		latest[o.OrderUID] = i
+	}
+	return latest
+}
+
+// olderRevision reports whether a precedes b by revision, then date_created.
+func olderRevision(a, b models.Order) bool {
+	if a.Revision != b.Revision {
+		return a.Revision < b.Revision
+	}
+	ta, errA := time.Parse(time.RFC3339Nano, a.DateCreated)
+	tb, errB := time.Parse(time.RFC3339Nano, b.DateCreated)
+	if errA != nil || errB != nil {
+		return a.DateCreated < b.DateCreated
+	}
+	return ta.Before(tb)
+}
+
+// contentHash identifies the content of an order independently of how its
+// message was formatted.
+func contentHash(o models.Order) (string, error) {
+	b, err := json.Marshal(o)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+const orderColumnCount = 16
+
+func orderArgs(o models.Order, hash string) ([]any, error) {
+	deliveryJSON, err := json.Marshal(o.Delivery)
+	if err != nil {
+		return nil, err
+	}
 	paymentJSON, err := json.Marshal(o.Payment)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	itemsJSON, err := json.Marshal(o.Items)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	_, err = tx.ExecContext(ctx, `
-            INSERT INTO orders (
-                order_uid, track_number, entry, delivery, payment, items, locale,
-                internal_signature, customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard
-            ) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14)
+	return []any{
+		o.OrderUID, o.TrackNumber, o.Entry,
+		deliveryJSON, paymentJSON, itemsJSON,
+		o.Locale, o.InternalSig, o.CustomerID, o.DeliverySvc,
+		o.ShardKey, o.SmID, o.DateCreated, o.OofShard,
+		o.Revision, hash,
+	}, nil
+}
+
+// buildUpsert returns an INSERT of n rows of insertColumns. An existing order
+// is overwritten only by different content of the same or a newer revision;
+// the statement returns the order_uid of every row it wrote.
+func buildUpsert(n int) string {
+	var b strings.Builder
+	b.WriteString(`INSERT INTO orders (` + insertColumns + `) VALUES `)
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString("(")
+		for j := 0; j < orderColumnCount; j++ {
+			if j > 0 {
+				b.WriteString(",")
+			}
+			b.WriteString("$" + strconv.Itoa(i*orderColumnCount+j+1))
+		}
+		b.WriteString(")")
+	}
+	b.WriteString(`
             ON CONFLICT (order_uid) DO UPDATE SET
                 track_number=EXCLUDED.track_number,
                 entry=EXCLUDED.entry,
@@ -59,36 +283,35 @@ func (r *PostgresOrderRepository) Save(ctx context.Context, o models.Order) erro
                 shardkey=EXCLUDED.shardkey,
                 sm_id=EXCLUDED.sm_id,
                 date_created=EXCLUDED.date_created,
-                oof_shard=EXCLUDED.oof_shard
-        `,
-		o.OrderUID, o.TrackNumber, o.Entry,
-		deliveryJSON, paymentJSON, itemsJSON,
-		o.Locale, o.InternalSig, o.CustomerID, o.DeliverySvc,
-		o.ShardKey, o.SmID, o.DateCreated, o.OofShard,
-	)
-	if err != nil {
-		return err
-	}
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("commit: %w", err)
-	}
-	return nil
+                oof_shard=EXCLUDED.oof_shard,
+                version=EXCLUDED.version,
+                content_hash=EXCLUDED.content_hash,
+                updated_at=now()
+            WHERE orders.content_hash IS DISTINCT FROM EXCLUDED.content_hash
+              AND (EXCLUDED.version, COALESCE(EXCLUDED.date_created, '-infinity'))
+                  >= (orders.version, COALESCE(orders.date_created, '-infinity'))
+            RETURNING order_uid`)
+	return b.String()
 }
 
-func (r *PostgresOrderRepository) Get(ctx context.Context, id string) (models.Order, error) {
+const orderColumns = `order_uid, track_number, entry, delivery, payment, items, locale,
+        internal_signature, customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard, version`
+
+const insertColumns = orderColumns + `, content_hash`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanOrder(row rowScanner) (models.Order, error) {
 	var (
 		o         models.Order
 		deliveryB []byte
 		paymentB  []byte
 		itemsB    []byte
 	)
-	err := r.db.QueryRowContext(ctx, `SELECT order_uid, track_number, entry, delivery, payment, items, locale,
-        internal_signature, customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard FROM orders WHERE order_uid=$1`, id).
-		Scan(&o.OrderUID, &o.TrackNumber, &o.Entry, &deliveryB, &paymentB, &itemsB, &o.Locale, &o.InternalSig, &o.CustomerID, &o.DeliverySvc, &o.ShardKey, &o.SmID, &o.DateCreated, &o.OofShard)
+	err := row.Scan(&o.OrderUID, &o.TrackNumber, &o.Entry, &deliveryB, &paymentB, &itemsB, &o.Locale, &o.InternalSig, &o.CustomerID, &o.DeliverySvc, &o.ShardKey, &o.SmID, &o.DateCreated, &o.OofShard, &o.Revision)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return models.Order{}, ErrNotFound
-		}
 		return models.Order{}, err
 	}
 	_ = json.Unmarshal(deliveryB, &o.Delivery)
@@ -96,3 +319,74 @@ func (r *PostgresOrderRepository) Get(ctx context.Context, id string) (models.Or
 	_ = json.Unmarshal(itemsB, &o.Items)
 	return o, nil
 }
+
+func (r *PostgresOrderRepository) Get(ctx context.Context, id string) (models.Order, error) {
+	o, err := scanOrder(r.db.QueryRowContext(ctx, `SELECT `+orderColumns+` FROM orders WHERE order_uid=$1`, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Order{}, ErrNotFound
+		}
+		return models.Order{}, err
+	}
+	if r.normalized {
+		orders := []models.Order{o}
+		if err := loadDetails(ctx, r.db, orders); err != nil {
+			return models.Order{}, err
+		}
+		o = orders[0]
+	}
+	return o, nil
+}
+
+// streamChunk is how many orders StreamRecent loads details for at once in
+// the normalized layout.
+const streamChunk = 500
+
+// StreamRecent calls fn for the limit most recently created orders, oldest
+// first, so that feeding them into an LRU cache keeps the newest ones hottest.
+func (r *PostgresOrderRepository) StreamRecent(ctx context.Context, limit int, fn func(models.Order) error) error {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+orderColumns+` FROM (
+            SELECT `+orderColumns+` FROM orders ORDER BY date_created DESC NULLS LAST LIMIT $1
+        ) recent ORDER BY date_created ASC NULLS FIRST`, limit)
+	if err != nil {
+		return fmt.Errorf("query recent: %w", err)
+	}
+	defer rows.Close()
+	var buf []models.Order
+	flush := func() error {
+		if err := loadDetails(ctx, r.db, buf); err != nil {
+			return err
+		}
+		for _, o := range buf {
+			if err := fn(o); err != nil {
+				return err
+			}
+		}
+		buf = buf[:0]
+		return nil
+	}
+	for rows.Next() {
+		o, err := scanOrder(rows)
+		if err != nil {
+			return fmt.Errorf("scan: %w", err)
+		}
+		if !r.normalized {
+			if err := fn(o); err != nil {
+				return err
+			}
+			continue
+		}
+		if buf = append(buf, o); len(buf) == streamChunk {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(buf) > 0 {
+		return flush()
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/neptship/wbtech-orders/internal/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildUpsert_NumbersPlaceholdersPerRow(t *testing.T) {
+	q := buildUpsert(2)
+	require.Contains(t, q, "($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16),($17,")
+	require.Contains(t, q, "$32)")
+	require.NotContains(t, q, "$33")
+	require.True(t, strings.Contains(q, "ON CONFLICT (order_uid) DO UPDATE"))
+	require.True(t, strings.Contains(q, "RETURNING order_uid"))
+}
+
+func TestLatestByUID_PicksNewestRevision(t *testing.T) {
+	got := latestByUID([]models.Order{
+		{OrderUID: "a", Revision: 2},
+		{OrderUID: "b", DateCreated: "2021-11-26T06:22:19Z"},
+		{OrderUID: "a", Revision: 1},
+		{OrderUID: "b", DateCreated: "2021-11-26T09:22:19+03:00"},
+		{OrderUID: "c", DateCreated: "2021-11-27T06:22:19Z"},
+		{OrderUID: "c", DateCreated: "2021-11-26T06:22:19Z"},
+	})
+	require.Equal(t, map[string]int{"a": 0, "b": 3, "c": 4}, got)
+}
+
+func TestContentHash_IgnoresFormatting(t *testing.T) {
+	var a, b models.Order
+	require.NoError(t, json.Unmarshal([]byte(`{"order_uid":"a","sm_id":1}`), &a))
+	require.NoError(t, json.Unmarshal([]byte("{\n  \"sm_id\": 1,\n  \"order_uid\": \"a\"\n}"), &b))
+	ha, err := contentHash(a)
+	require.NoError(t, err)
+	hb, err := contentHash(b)
+	require.NoError(t, err)
+	require.Equal(t, ha, hb)
+	a.Revision = 1
+	hc, err := contentHash(a)
+	require.NoError(t, err)
+	require.NotEqual(t, ha, hc)
+}
+
+func TestOrderArgs_MatchesColumnCount(t *testing.T) {
+	args, err := orderArgs(models.Order{OrderUID: "a"}, "h")
+	require.NoError(t, err)
+	require.Len(t, args, orderColumnCount)
+	require.Len(t, strings.Split(insertColumns, ","), orderColumnCount)
+}
+
+func TestBuildInsert_NumbersPlaceholdersAcrossRows(t *testing.T) {
+	q, args := buildInsert("payments", "order_uid, currency", [][]any{{"a", "USD"}, {"b", "RUB"}})
+	require.Equal(t, "INSERT INTO payments (order_uid, currency) VALUES ($1,$2),($3,$4)", q)
+	require.Equal(t, []any{"a", "USD", "b", "RUB"}, args)
+}
@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// OutboxMessage is a submitted order waiting in the outbox table to be
+// published to Kafka. Headers carry the request ID and trace context of the
+// submitting request.
+type OutboxMessage struct {
+	ID       int64
+	OrderUID string
+	Payload  []byte
+	Headers  map[string]string
+	Attempts int
+}
+
+// OutboxResult is what PublishPending did: how many messages it sent and
+// the message it gave up on, if any.
+type OutboxResult struct {
+	Sent      int
+	Abandoned *OutboxMessage
+}
+
+// ErrOutboxRejected marks a publish error that retrying cannot fix, so the
+// message is abandoned at once.
+var ErrOutboxRejected = errors.New("message rejected")
+
+type OutboxRepository interface {
+	Enqueue(ctx context.Context, orderUID string, payload []byte, headers map[string]string) error
+	PublishPending(ctx context.Context, limit int, publish func(ctx context.Context, msgs []OutboxMessage) (int, error)) (OutboxResult, error)
+}
+
+type PostgresOutboxRepository struct {
+	db          *sql.DB
+	maxAttempts int
+}
+
+// NewPostgresOutbox returns an outbox that abandons a message after
+// maxAttempts failed publishes.
+func NewPostgresOutbox(db *sql.DB, maxAttempts int) *PostgresOutboxRepository {
+	return &PostgresOutboxRepository{db: db, maxAttempts: maxAttempts}
+}
+
+// Enqueue stores the submission and marks it queued in order_ingestion in
+// the same transaction.
+func (r *PostgresOutboxRepository) Enqueue(ctx context.Context, orderUID string, payload []byte, headers map[string]string) error {
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	h, err := json.Marshal(headers)
+	if err != nil {
+		return err
+	}
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO outbox (order_uid, payload, headers) VALUES ($1, $2, $3)`, orderUID, payload, h); err != nil {
+		return fmt.Errorf("insert outbox: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, markQueuedQuery, orderUID); err != nil {
+		return fmt.Errorf("mark queued: %w", err)
+	}
+	return tx.Commit()
+}
+
+// outboxLockKey is the advisory lock held by the relay that is publishing, so
+// that only one relay at a time works through the outbox.
+const outboxLockKey int64 = 7306580427351523601
+
+// PublishPending hands up to limit unsent messages, oldest first, to publish,
+// which returns how many of them, from the start, it published. Those are
+// marked sent; if publish failed, the error is recorded on the first
+// unpublished row and returned. Stopping there keeps later revisions of an
+// order from being published ahead of earlier ones. The row is abandoned,
+// and no longer blocks the ones behind it, once the error wraps
+// ErrOutboxRejected or it has failed maxAttempts times.
+//
+// The call holds a session advisory lock but no transaction while publish
+// talks to the broker. If another relay holds the lock, it returns (0, nil).
+func (r *PostgresOutboxRepository) PublishPending(ctx context.Context, limit int, publish func(ctx context.Context, msgs []OutboxMessage) (int, error)) (OutboxResult, error) {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return OutboxResult{}, err
+	}
+	defer conn.Close()
+	var locked bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, outboxLockKey).Scan(&locked); err != nil {
+		return OutboxResult{}, fmt.Errorf("acquire outbox lock: %w", err)
+	}
+	if !locked {
+		return OutboxResult{}, nil
+	}
+	defer func() {
+		_, _ = conn.ExecContext(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock($1)`, outboxLockKey)
+	}()
+
+	pending, err := pendingOutbox(ctx, conn, limit)
+	if err != nil || len(pending) == 0 {
+		return OutboxResult{}, err
+	}
+	n, publishErr := publish(ctx, pending)
+	n = min(max(n, 0), len(pending))
+	if n > 0 {
+		sent := make([]int64, n)
+		for i, m := range pending[:n] {
+			sent[i] = m.ID
+		}
+		if _, err := conn.ExecContext(context.WithoutCancel(ctx),
+			`UPDATE outbox SET sent_at=now(), attempts=attempts+1, last_error=NULL WHERE id = ANY($1)`, pq.Array(sent)); err != nil {
+			return OutboxResult{}, err
+		}
+	}
+	res := OutboxResult{Sent: n}
+	if publishErr != nil && n < len(pending) {
+		m := pending[n]
+		abandon := errors.Is(publishErr, ErrOutboxRejected) || m.Attempts+1 >= r.maxAttempts
+		if _, err := conn.ExecContext(context.WithoutCancel(ctx),
+			`UPDATE outbox SET attempts=attempts+1, last_error=$2,
+                abandoned_at=CASE WHEN $3 THEN now() END WHERE id=$1`, m.ID, publishErr.Error(), abandon); err != nil {
+			return res, err
+		}
+		if abandon {
+			m.Attempts++
+			res.Abandoned = &m
+		}
+	}
+	return res, publishErr
+}
+
+func pendingOutbox(ctx context.Context, conn *sql.Conn, limit int) ([]OutboxMessage, error) {
+	rows, err := conn.QueryContext(ctx, `
+            SELECT id, order_uid, payload, headers, attempts
+            FROM outbox WHERE sent_at IS NULL AND abandoned_at IS NULL
+            ORDER BY id LIMIT $1
+        `, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var pending []OutboxMessage
+	for rows.Next() {
+		var (
+			m OutboxMessage
+			h []byte
+		)
+		if err := rows.Scan(&m.ID, &m.OrderUID, &m.Payload, &h, &m.Attempts); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(h, &m.Headers); err != nil {
+			return nil, fmt.Errorf("outbox message %d headers: %w", m.ID, err)
+		}
+		pending = append(pending, m)
+	}
+	return pending, rows.Err()
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"database/sql"
+
+	"github.com/neptship/wbtech-orders/internal/cache"
+	"github.com/neptship/wbtech-orders/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var outboxMessages = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+	Name: "outbox_messages_total",
+	Help: "Outbox rows handed to Kafka by the relay, by result: sent, failed or abandoned.",
+}, []string{"result"})
+
+func registerMetrics(reg prometheus.Registerer, db *sql.DB, c cache.Cache) {
+	auto := promauto.With(reg)
+	cacheStat := func(f func(cache.Stats) float64) func() float64 {
+		return func() float64 { return f(c.Stats()) }
+	}
+	auto.NewCounterFunc(prometheus.CounterOpts{Name: "orders_cache_hits_total", Help: "Order cache hits."},
+		cacheStat(func(s cache.Stats) float64 { return float64(s.Hits) }))
+	auto.NewCounterFunc(prometheus.CounterOpts{Name: "orders_cache_misses_total", Help: "Order cache misses."},
+		cacheStat(func(s cache.Stats) float64 { return float64(s.Misses) }))
+	auto.NewCounterFunc(prometheus.CounterOpts{Name: "orders_cache_evictions_total", Help: "Orders evicted from the cache to stay within its size."},
+		cacheStat(func(s cache.Stats) float64 { return float64(s.Evictions) }))
+	auto.NewCounterFunc(prometheus.CounterOpts{Name: "orders_cache_expirations_total", Help: "Orders dropped from the cache after their TTL."},
+		cacheStat(func(s cache.Stats) float64 { return float64(s.Expirations) }))
+	auto.NewGaugeFunc(prometheus.GaugeOpts{Name: "orders_cache_size", Help: "Orders currently cached."},
+		cacheStat(func(s cache.Stats) float64 { return float64(s.Size) }))
+	auto.NewGaugeFunc(prometheus.GaugeOpts{Name: "orders_cache_capacity", Help: "Maximum number of cached orders, 0 if unbounded."},
+		cacheStat(func(s cache.Stats) float64 { return float64(s.Capacity) }))
+
+	dbStat := func(f func(sql.DBStats) float64) func() float64 {
+		return func() float64 { return f(db.Stats()) }
+	}
+	auto.NewGaugeFunc(prometheus.GaugeOpts{Name: "db_max_open_connections", Help: "Maximum number of open connections to Postgres."},
+		dbStat(func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) }))
+	auto.NewGaugeFunc(prometheus.GaugeOpts{Name: "db_open_connections", Help: "Established connections, in use and idle."},
+		dbStat(func(s sql.DBStats) float64 { return float64(s.OpenConnections) }))
+	auto.NewGaugeFunc(prometheus.GaugeOpts{Name: "db_in_use_connections", Help: "Connections currently in use."},
+		dbStat(func(s sql.DBStats) float64 { return float64(s.InUse) }))
+	auto.NewGaugeFunc(prometheus.GaugeOpts{Name: "db_idle_connections", Help: "Idle connections."},
+		dbStat(func(s sql.DBStats) float64 { return float64(s.Idle) }))
+	auto.NewCounterFunc(prometheus.CounterOpts{Name: "db_wait_count_total", Help: "Connections waited for."},
+		dbStat(func(s sql.DBStats) float64 { return float64(s.WaitCount) }))
+	auto.NewCounterFunc(prometheus.CounterOpts{Name: "db_wait_duration_seconds_total", Help: "Time blocked waiting for a new connection."},
+		dbStat(func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }))
+	auto.NewCounterFunc(prometheus.CounterOpts{Name: "db_max_idle_closed_total", Help: "Connections closed due to SetMaxIdleConns."},
+		dbStat(func(s sql.DBStats) float64 { return float64(s.MaxIdleClosed) }))
+	auto.NewCounterFunc(prometheus.CounterOpts{Name: "db_max_lifetime_closed_total", Help: "Connections closed due to SetConnMaxLifetime."},
+		dbStat(func(s sql.DBStats) float64 { return float64(s.MaxLifetimeClosed) }))
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/neptship/wbtech-orders/internal/kafka"
+	"github.com/neptship/wbtech-orders/internal/logging"
+	"github.com/neptship/wbtech-orders/internal/repository"
+	kafkago "github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// enqueue writes the submission to the outbox together with the request ID
+// and trace context, so the relay can publish it as if from the request.
+func (s *Service) enqueue(ctx context.Context, orderUID string, raw []byte) error {
+	headers := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, headers)
+	if id := logging.RequestID(ctx); id != "" {
+		headers[kafka.HeaderRequestID] = id
+	}
+	return s.Outbox.Enqueue(ctx, orderUID, raw, headers)
+}
+
+// StartOutboxRelay publishes pending outbox rows until ctx is done. It polls
+// every Outbox.PollInterval, immediately again while full batches come back,
+// and backs off like the consumer while Kafka is unavailable. A row the
+// outbox abandons is recorded as rejected and the relay moves on at once.
+func (s *Service) StartOutboxRelay(ctx context.Context) {
+	go func() {
+		backoff, maxBackoff, poll := s.cfg.Kafka.RetryBackoff, s.cfg.Kafka.RetryMaxBackoff, s.cfg.Outbox.PollInterval
+		// The same floors as the consumer's, so that a zero setting cannot
+		// turn the relay into a busy loop against Postgres and Kafka.
+		if backoff <= 0 {
+			backoff = 500 * time.Millisecond
+		}
+		if maxBackoff < backoff {
+			maxBackoff = backoff
+		}
+		if poll <= 0 {
+			poll = time.Second
+		}
+		slog.Info("outbox relay started", "poll_interval", poll.String())
+		delay := backoff
+		for {
+			res, err := s.Outbox.PublishPending(ctx, s.cfg.Outbox.BatchSize, s.publishOutbox)
+			wait := poll
+			switch {
+			case ctx.Err() != nil:
+				slog.Info("outbox relay stopping", "reason", ctx.Err())
+				return
+			case res.Abandoned != nil:
+				m := res.Abandoned
+				slog.Error("outbox message abandoned", "id", m.ID, "order_uid", m.OrderUID, "attempts", m.Attempts, "err", err)
+				outboxMessages.WithLabelValues("abandoned").Inc()
+				s.trackIngestion(ctx, m.OrderUID, func(ir repository.IngestionRepository) error {
+					return ir.MarkRejected(ctx, m.OrderUID, ReasonPublishFailed, err.Error())
+				})
+				delay = backoff
+				wait = 0
+			case err != nil:
+				slog.Warn("outbox relay failed, retrying", "sent", res.Sent, "retry_in", delay.String(), "err", err)
+				wait = delay
+				delay = min(delay*2, maxBackoff)
+			default:
+				delay = backoff
+				if res.Sent > 0 && res.Sent == s.cfg.Outbox.BatchSize {
+					wait = 0
+				}
+			}
+			select {
+			case <-ctx.Done():
+				slog.Info("outbox relay stopping", "reason", ctx.Err())
+				return
+			case <-time.After(wait):
+			}
+		}
+	}()
+}
+
+// publishOutbox publishes pending with one write. The stored headers already
+// hold the request ID and trace context of the submitting request. An error
+// about the message itself is wrapped in repository.ErrOutboxRejected.
+func (s *Service) publishOutbox(ctx context.Context, pending []repository.OutboxMessage) (int, error) {
+	msgs := make([]kafkago.Message, len(pending))
+	for i, m := range pending {
+		headers := make([]kafkago.Header, 0, len(m.Headers))
+		for k, v := range m.Headers {
+			headers = append(headers, kafkago.Header{Key: k, Value: []byte(v)})
+		}
+		msgs[i] = kafkago.Message{Key: []byte(m.OrderUID), Value: m.Payload, Headers: headers}
+	}
+	n, err := s.Producer.PublishBatch(ctx, msgs)
+	outboxMessages.WithLabelValues("sent").Add(float64(n))
+	if err != nil {
+		outboxMessages.WithLabelValues("failed").Inc()
+		if kafka.IsMessageRejected(err) {
+			err = fmt.Errorf("%w: %w", repository.ErrOutboxRejected, err)
+		}
+	}
+	return n, err
+}
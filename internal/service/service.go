@@ -3,33 +3,95 @@ package service
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"strings"
+	"log/slog"
+	"sync/atomic"
+	"time"
 
 	_ "github.com/lib/pq"
 	"github.com/neptship/wbtech-orders/internal/cache"
 	"github.com/neptship/wbtech-orders/internal/config"
+	"github.com/neptship/wbtech-orders/internal/health"
 	"github.com/neptship/wbtech-orders/internal/kafka"
+	"github.com/neptship/wbtech-orders/internal/metrics"
+	"github.com/neptship/wbtech-orders/internal/migrate"
 	"github.com/neptship/wbtech-orders/internal/models"
+	"github.com/neptship/wbtech-orders/internal/notify"
 	"github.com/neptship/wbtech-orders/internal/repository"
+	"github.com/neptship/wbtech-orders/internal/validation"
+	"github.com/neptship/wbtech-orders/migrations"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// Outcome is what the consumer did with an order: stored it, or rejected it
+// for Reason.
+type Outcome struct {
+	Order  models.Order
+	Reason string
+	Err    error
+}
+
+func (o Outcome) Saved() bool { return o.Reason == "" }
+
+var tracer = otel.Tracer("github.com/neptship/wbtech-orders/internal/service")
+
 type Service struct {
-	Producer *kafka.Producer
-	DB       *sql.DB
-	Cache    cache.Cache
-	Repo     repository.OrderRepository
-	cfg      config.Config
+	Producer    *kafka.Producer
+	DLQ         *kafka.Producer
+	DeadLetters *kafka.DeadLetters
+	DB          *sql.DB
+	Cache       cache.Cache
+	Repo        repository.OrderRepository
+	Ingestion   repository.IngestionRepository
+	Outbox      repository.OutboxRepository      // nil unless outbox mode is enabled
+	Idempotency repository.IdempotencyRepository // nil unless HTTP.IdempotencyTTL > 0
+	cfg         config.Config
+
+	outcomes notify.Hub[Outcome]
+	consumer atomic.Pointer[kafka.Consumer]
+	warming  atomic.Bool
+	stopping atomic.Bool
 }
 
-func New(ctx context.Context, cfg config.Config) (*Service, error) {
+// OpenDB connects to the Postgres database of cfg.
+func OpenDB(ctx context.Context, cfg config.Config) (*sql.DB, error) {
 	db, err := sql.Open("postgres", config.GetDSN(cfg.Postgres))
 	if err != nil {
 		return nil, fmt.Errorf("open db: %w", err)
 	}
 	if err := db.PingContext(ctx); err != nil {
+		_ = db.Close()
 		return nil, fmt.Errorf("ping db: %w", err)
 	}
+	return db, nil
+}
+
+// Migrate applies the pending embedded migrations to db.
+func Migrate(ctx context.Context, db *sql.DB) error {
+	m, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		return err
+	}
+	if _, err := m.Up(ctx); err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+	return nil
+}
+
+func New(ctx context.Context, cfg config.Config) (*Service, error) {
+	db, err := OpenDB(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Postgres.AutoMigrate {
+		if err := Migrate(ctx, db); err != nil {
+			return nil, err
+		}
+	}
 
 	producer, err := kafka.NewProducer(kafka.ProducerConfig{
 		Brokers: cfg.Kafka.Brokers,
@@ -38,41 +100,188 @@ func New(ctx context.Context, cfg config.Config) (*Service, error) {
 	if err != nil {
 		return nil, fmt.Errorf("new producer: %w", err)
 	}
+	dlq, err := kafka.NewProducer(kafka.ProducerConfig{
+		Brokers:         cfg.Kafka.Brokers,
+		Topic:           cfg.Kafka.DLQTopic,
+		AutoCreateTopic: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("new dlq producer: %w", err)
+	}
 
-	c := cache.NewCache(cfg.Cache.Size)
+	c := cache.NewCache(cfg.Cache.Size, cfg.Cache.TTL)
+	c.StartJanitor(ctx, cfg.Cache.JanitorInterval)
 
 	repo := repository.NewPostgres(db)
-	return &Service{Producer: producer, DB: db, Cache: c, Repo: repo, cfg: cfg}, nil
+	if cfg.Postgres.Layout == "normalized" {
+		repo = repository.NewPostgresNormalized(db)
+	}
+	registerMetrics(metrics.Registry, db, c)
+	svc := &Service{
+		Producer:    producer,
+		DLQ:         dlq,
+		DeadLetters: NewDeadLetters(cfg, producer),
+		DB:          db,
+		Cache:       c,
+		Repo:        repo,
+		Ingestion:   repository.NewPostgresIngestion(db),
+		cfg:         cfg,
+	}
+	if cfg.Outbox.Enabled {
+		svc.Outbox = repository.NewPostgresOutbox(db, cfg.Outbox.MaxAttempts)
+	}
+	if cfg.HTTP.IdempotencyTTL > 0 {
+		svc.Idempotency = repository.NewPostgresIdempotency(db)
+		svc.startIdempotencyJanitor(ctx, min(cfg.HTTP.IdempotencyTTL, time.Hour))
+	}
+	return svc, nil
 }
 
 func (s *Service) StartConsumer(ctx context.Context) {
+	consumer := kafka.NewConsumer(kafka.ConsumerConfig{
+		Brokers:         s.cfg.Kafka.Brokers,
+		Topic:           s.cfg.Kafka.Topic,
+		GroupID:         s.cfg.Kafka.GroupID,
+		Repo:            s.Repo,
+		Ingestion:       s.Ingestion,
+		DLQ:             s.DLQ,
+		Rules:           validation.NewRules(s.cfg.Validation.Rules),
+		RetryBackoff:    s.cfg.Kafka.RetryBackoff,
+		RetryMaxBackoff: s.cfg.Kafka.RetryMaxBackoff,
+		BatchSize:       s.cfg.Kafka.BatchSize,
+		BatchLinger:     s.cfg.Kafka.BatchLinger,
+		Concurrency:     s.cfg.Kafka.Concurrency,
+		MaxInFlight:     s.cfg.Kafka.MaxInFlight,
+	})
+	consumer.OnSaved = func(o models.Order) {
+		s.Cache.Set(o.OrderUID, o)
+		s.outcomes.Publish(o.OrderUID, Outcome{Order: o})
+	}
+	consumer.OnRejected = func(key, reason string, err error) {
+		s.outcomes.Publish(key, Outcome{Reason: reason, Err: err})
+	}
+	consumer.OnSkipped = func(o models.Order, reason string) {
+		if reason == kafka.ReasonDuplicate {
+			s.outcomes.Publish(o.OrderUID, Outcome{Order: o})
+			return
+		}
+		s.outcomes.Publish(o.OrderUID, Outcome{Reason: reason, Err: repository.ErrStale})
+	}
+	s.consumer.Store(consumer)
 	go func() {
-		consumer := kafka.NewConsumer(kafka.ConsumerConfig{
-			Brokers: s.cfg.Kafka.Brokers,
-			Topic:   s.cfg.Kafka.Topic,
-			GroupID: s.cfg.Kafka.GroupID,
-			DB:      s.DB,
-		})
-		consumer.OnSaved = func(o models.Order) { s.Cache.Set(o.OrderUID, o) }
 		go consumer.Run(ctx)
 		<-ctx.Done()
 		_ = consumer.Close()
 	}()
 }
 
-func (s *Service) PublishRawOrder(ctx context.Context, raw []byte) error {
-	key := extractField(raw, "order_uid")
-	if key == "" {
-		key = "unknown"
+// NewDeadLetters returns the dead-letter admin for cfg, re-driving messages
+// through target.
+func NewDeadLetters(cfg config.Config, target *kafka.Producer) *kafka.DeadLetters {
+	return kafka.NewDeadLetters(kafka.DeadLettersConfig{
+		Brokers: cfg.Kafka.Brokers,
+		Topic:   cfg.Kafka.DLQTopic,
+		GroupID: cfg.Kafka.GroupID + "-dlq-redrive",
+		Target:  target,
+	})
+}
+
+// ReasonPublishFailed is the ingestion rejection reason of an order that
+// never made it to Kafka.
+const ReasonPublishFailed = "publish_failed"
+
+// PublishOrder publishes raw keyed by orderUID, which the producer hashes to
+// pick the partition, so every revision of an order lands on the same one. It
+// records the submission as queued. In outbox mode it is only written to the
+// outbox table and published by the relay.
+func (s *Service) PublishOrder(ctx context.Context, orderUID string, raw []byte) error {
+	if orderUID == "" {
+		orderUID = repository.UnknownOrderUID
+	}
+	if s.Outbox != nil {
+		return s.enqueue(ctx, orderUID, raw)
 	}
-	return s.Producer.Publish(ctx, key, raw)
+	s.trackIngestion(ctx, orderUID, func(ir repository.IngestionRepository) error {
+		return ir.MarkQueued(ctx, orderUID)
+	})
+	if err := s.Producer.Publish(ctx, orderUID, raw); err != nil {
+		s.trackIngestion(ctx, orderUID, func(ir repository.IngestionRepository) error {
+			return ir.MarkRejected(ctx, orderUID, ReasonPublishFailed, err.Error())
+		})
+		return err
+	}
+	return nil
+}
+
+// IngestionStatus returns what is known about the latest submission of
+// orderUID.
+func (s *Service) IngestionStatus(ctx context.Context, orderUID string) (repository.Ingestion, error) {
+	return s.Ingestion.GetIngestion(ctx, orderUID)
+}
+
+// trackIngestion records a status change; a failure is logged but never
+// fails the submission itself.
+func (s *Service) trackIngestion(ctx context.Context, orderUID string, fn func(repository.IngestionRepository) error) {
+	if s.Ingestion == nil || !repository.Trackable(orderUID) {
+		return
+	}
+	if err := fn(s.Ingestion); err != nil {
+		slog.WarnContext(ctx, "record ingestion status failed", "order_uid", orderUID, "err", err)
+	}
+}
+
+// AwaitOutcome subscribes to what this process's consumer does with the next
+// message for orderUID. Call it before publishing so the outcome cannot be
+// missed, and call cancel when done waiting. Messages consumed by another
+// instance are never reported here.
+func (s *Service) AwaitOutcome(orderUID string) (<-chan Outcome, func()) {
+	return s.outcomes.Subscribe(orderUID)
 }
 
 func (s *Service) GetOrder(ctx context.Context, id string) (models.Order, error) {
+	ctx, span := tracer.Start(ctx, "Service.GetOrder", trace.WithAttributes(attribute.String("order.uid", id)))
+	defer span.End()
 	if o, ok := s.Cache.Get(id); ok {
+		span.SetAttributes(attribute.Bool("cache.hit", true))
+		return o, nil
+	}
+	span.SetAttributes(attribute.Bool("cache.hit", false))
+	rctx, rspan := tracer.Start(ctx, "OrderRepository.Get")
+	o, err := s.Repo.Get(rctx, id)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		rspan.RecordError(err)
+		rspan.SetStatus(codes.Error, err.Error())
+	}
+	rspan.End()
+	if err != nil {
+		return models.Order{}, err
+	}
+	s.Cache.Set(o.OrderUID, o)
+	return o, nil
+}
+
+func (s *Service) ListOrders(ctx context.Context, f repository.OrderFilter) (repository.OrderPage, error) {
+	return s.Repo.List(ctx, f)
+}
+
+// OrdersByTrack always asks the repository, since the cache may hold only
+// some of the orders with a track number, and caches what it finds.
+func (s *Service) OrdersByTrack(ctx context.Context, track string) ([]models.Order, error) {
+	orders, err := s.Repo.FindByTrack(ctx, track)
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range orders {
+		s.Cache.Set(o.OrderUID, o)
+	}
+	return orders, nil
+}
+
+func (s *Service) OrderByRID(ctx context.Context, rid string) (models.Order, error) {
+	if o, ok := s.Cache.GetByRID(rid); ok {
 		return o, nil
 	}
-	o, err := s.Repo.Get(ctx, id)
+	o, err := s.Repo.FindByRID(ctx, rid)
 	if err != nil {
 		return models.Order{}, err
 	}
@@ -80,17 +289,102 @@ func (s *Service) GetOrder(ctx context.Context, id string) (models.Order, error)
 	return o, nil
 }
 
-func extractField(b []byte, field string) string {
-	s := string(b)
-	needle := `"` + field + `":"`
-	idx := strings.Index(s, needle)
-	if idx == -1 {
-		return ""
+func (s *Service) OrdersByChrtID(ctx context.Context, chrtID int) ([]models.Order, error) {
+	return s.Repo.FindByChrtID(ctx, chrtID)
+}
+
+// Warmup loads the most recent orders into the cache, never more than the
+// cache can hold. The service reports not ready until it returns.
+func (s *Service) Warmup(ctx context.Context, limit int) error {
+	s.warming.Store(true)
+	defer s.warming.Store(false)
+	if capacity := s.Cache.Stats().Capacity; capacity > 0 && limit > capacity {
+		limit = capacity
+	}
+	if limit <= 0 {
+		return nil
 	}
-	rest := s[idx+len(needle):]
-	end := strings.Index(rest, `"`)
-	if end == -1 {
-		return ""
+	start := time.Now()
+	slog.Info("cache warmup started", "limit", limit)
+	n := 0
+	err := s.Repo.StreamRecent(ctx, limit, func(o models.Order) error {
+		s.Cache.Set(o.OrderUID, o)
+		n++
+		if n%1000 == 0 {
+			slog.Info("cache warmup progress", "loaded", n, "limit", limit)
+		}
+		return ctx.Err()
+	})
+	if err != nil {
+		return fmt.Errorf("cache warmup after %d orders: %w", n, err)
 	}
-	return rest[:end]
+	slog.Info("cache warmup finished", "loaded", n, "duration", time.Since(start).Round(time.Millisecond).String())
+	return nil
+}
+
+// startIdempotencyJanitor deletes expired Idempotency-Key records every
+// interval until ctx is done.
+func (s *Service) startIdempotencyJanitor(ctx context.Context, interval time.Duration) {
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				n, err := s.Idempotency.DeleteExpired(ctx)
+				if err != nil {
+					slog.Warn("delete expired idempotency keys failed", "err", err)
+					continue
+				}
+				if n > 0 {
+					slog.Debug("expired idempotency keys deleted", "count", n)
+				}
+			}
+		}
+	}()
+}
+
+// BeginShutdown marks the service as draining so that readiness fails
+// before the listeners go away.
+func (s *Service) BeginShutdown() {
+	s.stopping.Store(true)
+}
+
+// Readiness checks every dependency needed to serve traffic, each bounded by
+// timeout. In outbox mode Kafka is not one of them: submissions only need
+// Postgres, and the relay and consumer catch up once the brokers are back.
+func (s *Service) Readiness(ctx context.Context, timeout time.Duration) health.Report {
+	return health.Run(ctx, timeout, map[string]health.Check{
+		"postgres": s.DB.PingContext,
+		"kafka_producer": func(ctx context.Context) error {
+			if s.Outbox != nil {
+				return nil
+			}
+			return s.Producer.Ping(ctx)
+		},
+		"kafka_consumer": func(ctx context.Context) error {
+			c := s.consumer.Load()
+			if c == nil {
+				return errors.New("consumer not started")
+			}
+			if s.Outbox != nil {
+				return nil
+			}
+			return c.Ping(ctx)
+		},
+		"cache_warmup": func(context.Context) error {
+			if s.warming.Load() {
+				return errors.New("warmup in progress")
+			}
+			return nil
+		},
+		"shutdown": func(context.Context) error {
+			if s.stopping.Load() {
+				return errors.New("shutdown in progress")
+			}
+			return nil
+		},
+	})
 }
@@ -3,15 +3,22 @@ package service_test
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"testing"
 	"time"
 
 	_ "github.com/lib/pq"
 
 	"github.com/neptship/wbtech-orders/internal/cache"
+	"github.com/neptship/wbtech-orders/internal/kafka"
+	"github.com/neptship/wbtech-orders/internal/logging"
 	"github.com/neptship/wbtech-orders/internal/models"
 	"github.com/neptship/wbtech-orders/internal/repository"
 	"github.com/neptship/wbtech-orders/internal/service"
+	"github.com/neptship/wbtech-orders/mocks"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 func TestService_GetOrder_Integration(t *testing.T) {
@@ -32,7 +39,7 @@ func TestService_GetOrder_Integration(t *testing.T) {
 	orderUID := "integ-test-order-" + time.Now().Format("20060102150405")
 
 	repo := repository.NewPostgres(db)
-	c := cache.NewCache(0)
+	c := cache.NewCache(0, 0)
 
 	svc := &service.Service{Cache: c, Repo: repo}
 
@@ -69,3 +76,125 @@ func TestService_GetOrder_Integration(t *testing.T) {
 		t.Fatalf("unexpected order uid second: %s != %s", got2.OrderUID, want.OrderUID)
 	}
 }
+
+func TestService_Warmup(t *testing.T) {
+	repo := mocks.NewOrderRepositoryMock(t)
+	c := cache.NewCache(2, 0)
+	svc := &service.Service{Cache: c, Repo: repo}
+
+	repo.EXPECT().StreamRecent(mock.Anything, 2, mock.Anything).
+		RunAndReturn(func(_ context.Context, _ int, fn func(models.Order) error) error {
+			for _, id := range []string{"a", "b"} {
+				if err := fn(models.Order{OrderUID: id}); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+
+	require.NoError(t, svc.Warmup(context.Background(), 10))
+	require.Equal(t, 2, c.Len())
+
+	got, err := svc.GetOrder(context.Background(), "b")
+	require.NoError(t, err)
+	require.Equal(t, "b", got.OrderUID)
+}
+
+func TestService_OrderByRID_UsesCacheIndex(t *testing.T) {
+	repo := mocks.NewOrderRepositoryMock(t)
+	svc := &service.Service{Cache: cache.NewCache(10, 0), Repo: repo}
+	o := models.Order{OrderUID: "a", TrackNumber: "T1", Items: []models.Item{{RID: "r1"}}}
+
+	repo.EXPECT().FindByRID(mock.Anything, "r1").Return(o, nil).Once()
+
+	for i := 0; i < 2; i++ {
+		got, err := svc.OrderByRID(context.Background(), "r1")
+		require.NoError(t, err)
+		require.Equal(t, o, got)
+	}
+}
+
+func TestService_OrdersByTrack_QueriesRepositoryDespitePartialCache(t *testing.T) {
+	repo := mocks.NewOrderRepositoryMock(t)
+	svc := &service.Service{Cache: cache.NewCache(10, 0), Repo: repo}
+	a := models.Order{OrderUID: "a", TrackNumber: "T1"}
+	b := models.Order{OrderUID: "b", TrackNumber: "T1"}
+	svc.Cache.Set("a", a)
+
+	repo.EXPECT().FindByTrack(mock.Anything, "T1").Return([]models.Order{a, b}, nil).Once()
+
+	got, err := svc.OrdersByTrack(context.Background(), "T1")
+	require.NoError(t, err)
+	require.Equal(t, []models.Order{a, b}, got)
+	_, ok := svc.Cache.Get("b")
+	require.True(t, ok)
+}
+
+func TestService_PublishOrder_WritesOutbox(t *testing.T) {
+	outbox := mocks.NewOutboxRepositoryMock(t)
+	svc := &service.Service{Outbox: outbox}
+	ctx := logging.WithRequestID(context.Background(), "req-1")
+	raw := []byte(`{"order_uid":"a"}`)
+
+	outbox.EXPECT().Enqueue(mock.Anything, "a", raw, mock.MatchedBy(func(h map[string]string) bool {
+		return h[kafka.HeaderRequestID] == "req-1"
+	})).Return(nil).Once()
+
+	require.NoError(t, svc.PublishOrder(ctx, "a", raw))
+}
+
+func TestService_OutboxRelay_RejectsAbandonedMessage(t *testing.T) {
+	outbox := mocks.NewOutboxRepositoryMock(t)
+	ingestion := mocks.NewIngestionRepositoryMock(t)
+	svc := &service.Service{Outbox: outbox, Ingestion: ingestion}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	publishErr := fmt.Errorf("%w: message size too large", repository.ErrOutboxRejected)
+
+	outbox.EXPECT().PublishPending(mock.Anything, mock.Anything, mock.Anything).
+		Return(repository.OutboxResult{Abandoned: &repository.OutboxMessage{ID: 7, OrderUID: "a", Attempts: 1}}, publishErr).Once()
+	ingestion.EXPECT().MarkRejected(mock.Anything, "a", service.ReasonPublishFailed, publishErr.Error()).Return(nil).Once()
+	done := make(chan struct{})
+	outbox.EXPECT().PublishPending(mock.Anything, mock.Anything, mock.Anything).
+		RunAndReturn(func(context.Context, int, func(context.Context, []repository.OutboxMessage) (int, error)) (repository.OutboxResult, error) {
+			cancel()
+			close(done)
+			return repository.OutboxResult{}, nil
+		}).Once()
+
+	svc.StartOutboxRelay(ctx)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("relay did not move on after abandoning a message")
+	}
+}
+
+func TestService_OutboxRelay_BacksOffWithZeroConfig(t *testing.T) {
+	outbox := mocks.NewOutboxRepositoryMock(t)
+	svc := &service.Service{Outbox: outbox}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var first time.Time
+	outbox.EXPECT().PublishPending(mock.Anything, mock.Anything, mock.Anything).
+		RunAndReturn(func(context.Context, int, func(context.Context, []repository.OutboxMessage) (int, error)) (repository.OutboxResult, error) {
+			first = time.Now()
+			return repository.OutboxResult{}, errors.New("broker unavailable")
+		}).Once()
+	gap := make(chan time.Duration, 1)
+	outbox.EXPECT().PublishPending(mock.Anything, mock.Anything, mock.Anything).
+		RunAndReturn(func(context.Context, int, func(context.Context, []repository.OutboxMessage) (int, error)) (repository.OutboxResult, error) {
+			cancel()
+			gap <- time.Since(first)
+			return repository.OutboxResult{}, nil
+		}).Once()
+
+	svc.StartOutboxRelay(ctx)
+	select {
+	case d := <-gap:
+		require.GreaterOrEqual(t, d, 400*time.Millisecond)
+	case <-time.After(5 * time.Second):
+		t.Fatal("relay did not retry")
+	}
+}
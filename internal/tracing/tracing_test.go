@@ -0,0 +1,31 @@
+package tracing_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/neptship/wbtech-orders/internal/tracing"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+)
+
+func TestSetup_FileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.jsonl")
+	shutdown, err := tracing.Setup(tracing.Config{ServiceName: "test", Exporter: tracing.ExporterFile, File: path, SampleRatio: 1})
+	require.NoError(t, err)
+
+	_, span := otel.Tracer("test").Start(context.Background(), "Service.GetOrder")
+	span.End()
+	require.NoError(t, shutdown(context.Background()))
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(b), `"Name":"Service.GetOrder"`)
+}
+
+func TestSetup_UnknownExporter(t *testing.T) {
+	_, err := tracing.Setup(tracing.Config{Exporter: "zipkin"})
+	require.Error(t, err)
+}
@@ -0,0 +1,101 @@
+package validation
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/neptship/wbtech-orders/internal/models"
+)
+
+const CodeMismatch = "mismatch"
+
+type Mode string
+
+const (
+	ModeOff    Mode = "off"
+	ModeWarn   Mode = "warn"
+	ModeStrict Mode = "strict"
+)
+
+const (
+	RuleGoodsTotal      = "goods_total"
+	RuleItemTotalPrice  = "item_total_price"
+	RuleAmount          = "amount"
+	RuleItemTrackNumber = "item_track_number"
+)
+
+// Rules maps a consistency rule to how its violations are treated: strict
+// rejects the order, warn only flags it, off skips the check.
+type Rules map[string]Mode
+
+// NewRules builds Rules from raw config values, keeping ModeWarn for rules
+// that are not set or set to an unknown mode.
+func NewRules(raw map[string]string) Rules {
+	r := Rules{
+		RuleGoodsTotal:      ModeWarn,
+		RuleItemTotalPrice:  ModeWarn,
+		RuleAmount:          ModeWarn,
+		RuleItemTrackNumber: ModeWarn,
+	}
+	for name, v := range raw {
+		if _, known := r[name]; !known {
+			continue
+		}
+		switch m := Mode(strings.ToLower(strings.TrimSpace(v))); m {
+		case ModeOff, ModeWarn, ModeStrict:
+			r[name] = m
+		}
+	}
+	return r
+}
+
+// Check runs Validate plus the consistency rules. Violations of strict rules
+// are returned with the schema errors, those of warn rules as warnings.
+func Check(o models.Order, rules Rules) (errs, warnings Errors) {
+	errs = Validate(o)
+	strict, warn := Consistency(o, rules)
+	return append(errs, strict...), warn
+}
+
+// Consistency cross-checks payment totals against the items.
+func Consistency(o models.Order, rules Rules) (strict, warnings Errors) {
+	report := func(rule, field, msg string) {
+		fe := FieldError{Field: field, Code: CodeMismatch, Message: msg}
+		switch rules[rule] {
+		case ModeStrict:
+			strict = append(strict, fe)
+		case ModeWarn:
+			warnings = append(warnings, fe)
+		}
+	}
+
+	goods := 0
+	for i, it := range o.Items {
+		goods += it.TotalPrice
+		if want := it.Price * (100 - it.Sale) / 100; abs(it.TotalPrice-want) > 1 {
+			report(RuleItemTotalPrice, fmt.Sprintf("items[%d].total_price", i),
+				fmt.Sprintf("expected %d for price %d with %d%% sale, got %d", want, it.Price, it.Sale, it.TotalPrice))
+		}
+		if it.TrackNumber != o.TrackNumber {
+			report(RuleItemTrackNumber, fmt.Sprintf("items[%d].track_number", i),
+				fmt.Sprintf("expected order track number %q, got %q", o.TrackNumber, it.TrackNumber))
+		}
+	}
+	p := o.Payment
+	if p.GoodsTotal != goods {
+		report(RuleGoodsTotal, "payment.goods_total",
+			fmt.Sprintf("expected sum of item total prices %d, got %d", goods, p.GoodsTotal))
+	}
+	if want := p.GoodsTotal + p.DeliveryCost + p.CustomFee; p.Amount != want {
+		report(RuleAmount, "payment.amount",
+			fmt.Sprintf("expected goods_total + delivery_cost + custom_fee = %d, got %d", want, p.Amount))
+	}
+	return strict, warnings
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
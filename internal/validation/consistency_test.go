@@ -0,0 +1,58 @@
+package validation_test
+
+import (
+	"testing"
+
+	"github.com/neptship/wbtech-orders/internal/models"
+	"github.com/neptship/wbtech-orders/internal/validation"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsistency_SampleOrderIsConsistent(t *testing.T) {
+	rules := validation.NewRules(map[string]string{
+		validation.RuleGoodsTotal:      "strict",
+		validation.RuleItemTotalPrice:  "strict",
+		validation.RuleAmount:          "strict",
+		validation.RuleItemTrackNumber: "strict",
+	})
+	strict, warnings := validation.Consistency(sampleOrder(), rules)
+	require.Empty(t, strict)
+	require.Empty(t, warnings)
+}
+
+func TestConsistency_ModesPerRule(t *testing.T) {
+	o := sampleOrder()
+	o.Payment.GoodsTotal = 300
+	o.Items[0].TrackNumber = "OTHER"
+	o.Items = append(o.Items, models.Item{Price: 100, Sale: 10, TotalPrice: 50, TrackNumber: o.TrackNumber})
+
+	rules := validation.NewRules(map[string]string{
+		validation.RuleGoodsTotal:      "strict",
+		validation.RuleItemTotalPrice:  "warn",
+		validation.RuleAmount:          "off",
+		validation.RuleItemTrackNumber: "bogus",
+	})
+	strict, warnings := validation.Consistency(o, rules)
+
+	require.Equal(t, []string{"payment.goods_total"}, fields(t, strict))
+	require.Equal(t, []string{"items[0].track_number", "items[1].total_price"}, fields(t, warnings))
+}
+
+func TestCheck_StrictRulesAreErrors(t *testing.T) {
+	o := sampleOrder()
+	o.Payment.Amount = 1
+
+	errs, warnings := validation.Check(o, validation.NewRules(map[string]string{validation.RuleAmount: "strict"}))
+	require.Equal(t, []string{"payment.amount"}, fields(t, errs))
+	require.Empty(t, warnings)
+}
+
+func fields(t *testing.T, errs validation.Errors) []string {
+	t.Helper()
+	var out []string
+	for _, fe := range errs {
+		require.Equal(t, validation.CodeMismatch, fe.Code)
+		out = append(out, fe.Field)
+	}
+	return out
+}
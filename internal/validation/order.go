@@ -1,59 +1,15 @@
 package validation
 
 import (
-	"errors"
+	"fmt"
+	"math"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/neptship/wbtech-orders/internal/models"
 )
 
-var (
-	ErrEmptyOrderUID  = errors.New("order_uid empty")
-	ErrOrderUIDFormat = errors.New("order_uid has invalid characters")
-	ErrOrderUIDLen    = errors.New("order_uid too long")
-	ErrEmptyTrack     = errors.New("track_number empty")
-	ErrNoItems        = errors.New("items empty")
-	ErrNegativeAmount = errors.New("payment amount negative")
-	ErrInvalidEmail   = errors.New("delivery email invalid")
-)
-
-func Basic(o any, track ...string) error {
-	switch v := o.(type) {
-	case models.Order:
-		uid := strings.TrimSpace(v.OrderUID)
-		if uid == "" {
-			return ErrEmptyOrderUID
-		}
-		if len(uid) > 100 {
-			return ErrOrderUIDLen
-		}
-		if !isSafeID(uid) {
-			return ErrOrderUIDFormat
-		}
-		if strings.TrimSpace(v.TrackNumber) == "" {
-			return ErrEmptyTrack
-		}
-		if len(v.Items) == 0 {
-			return ErrNoItems
-		}
-		if v.Payment.Amount < 0 {
-			return ErrNegativeAmount
-		}
-		if e := strings.TrimSpace(v.Delivery.Email); e != "" && !strings.Contains(e, "@") {
-			return ErrInvalidEmail
-		}
-	case string:
-		if strings.TrimSpace(v) == "" {
-			return ErrEmptyOrderUID
-		}
-		if len(track) > 0 && strings.TrimSpace(track[0]) == "" {
-			return ErrEmptyTrack
-		}
-	default:
-	}
-	return nil
-}
-
 func isSafeID(s string) bool {
 	for _, r := range s {
 		if r >= 'a' && r <= 'z' {
@@ -69,3 +25,203 @@ func isSafeID(s string) bool {
 	}
 	return true
 }
+
+const (
+	CodeRequired      = "required"
+	CodeTooLong       = "too_long"
+	CodeInvalidFormat = "invalid_format"
+	CodeInvalidEmail  = "invalid_email"
+	CodeInvalidDate   = "invalid_date"
+	CodeNegative      = "negative"
+	CodeOutOfRange    = "out_of_range"
+	CodeEmpty         = "empty"
+)
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string { return e.Field + ": " + e.Code }
+
+// Errors is every violation found in an order; a nil Errors means valid.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	parts := make([]string, len(e))
+	for i, fe := range e {
+		parts[i] = fe.Error()
+	}
+	return strings.Join(parts, "; ")
+}
+
+func (e Errors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+type checker struct {
+	errs Errors
+}
+
+func (c *checker) add(field, code, msg string) {
+	c.errs = append(c.errs, FieldError{Field: field, Code: code, Message: msg})
+}
+
+// required reports v if it is blank or, counting untrimmed characters as the
+// VARCHAR(max) column it is stored in does, longer than max.
+func (c *checker) required(field, v string, max int) {
+	switch {
+	case strings.TrimSpace(v) == "":
+		c.add(field, CodeRequired, "must not be empty")
+	case max > 0 && utf8.RuneCountInString(v) > max:
+		c.add(field, CodeTooLong, fmt.Sprintf("must be at most %d characters", max))
+	}
+}
+
+func (c *checker) optional(field, v string, max int) {
+	if utf8.RuneCountInString(v) > max {
+		c.add(field, CodeTooLong, fmt.Sprintf("must be at most %d characters", max))
+	}
+}
+
+func (c *checker) nonNegative(field string, v int64) {
+	if v < 0 {
+		c.add(field, CodeNegative, "must not be negative")
+	}
+}
+
+// nonNegativeInt is nonNegative for a value stored in an INTEGER column.
+func (c *checker) nonNegativeInt(field string, v int) {
+	c.nonNegative(field, int64(v))
+	if v > math.MaxInt32 {
+		c.add(field, CodeOutOfRange, fmt.Sprintf("must be at most %d", math.MaxInt32))
+	}
+}
+
+func (c *checker) positive(field string, v int64) {
+	if v <= 0 {
+		c.add(field, CodeOutOfRange, "must be a positive number")
+	}
+}
+
+// Validate checks the whole order against the storage schema and the
+// upstream contract and reports every violation at once.
+func Validate(o models.Order) Errors {
+	c := &checker{}
+
+	c.required("order_uid", o.OrderUID, 100)
+	if uid := strings.TrimSpace(o.OrderUID); uid != "" && !isSafeID(uid) {
+		c.add("order_uid", CodeInvalidFormat, "must contain only latin letters and digits")
+	}
+	c.required("track_number", o.TrackNumber, 50)
+	c.required("entry", o.Entry, 10)
+	c.required("locale", o.Locale, 10)
+	c.optional("internal_signature", o.InternalSig, 100)
+	c.required("customer_id", o.CustomerID, 50)
+	c.required("delivery_service", o.DeliverySvc, 50)
+	c.optional("shardkey", o.ShardKey, 10)
+	c.nonNegativeInt("sm_id", o.SmID)
+	c.optional("oof_shard", o.OofShard, 10)
+	if strings.TrimSpace(o.DateCreated) == "" {
+		c.add("date_created", CodeRequired, "must not be empty")
+	} else if _, err := time.Parse(time.RFC3339, o.DateCreated); err != nil {
+		c.add("date_created", CodeInvalidDate, "must be an RFC 3339 timestamp")
+	}
+
+	validateDelivery(c, o.Delivery)
+	validatePayment(c, o.Payment)
+
+	if len(o.Items) == 0 {
+		c.add("items", CodeEmpty, "must contain at least one item")
+	}
+	for i, it := range o.Items {
+		validateItem(c, fmt.Sprintf("items[%d]", i), it)
+	}
+	return c.errs
+}
+
+// The limits below are those of the deliveries, payments and order_items
+// tables, so that an order accepted in one storage layout is accepted in the
+// other as well. Formats are checked on the value as it will be stored.
+
+func validateDelivery(c *checker, d models.Delivery) {
+	c.required("delivery.name", d.Name, 255)
+	c.required("delivery.phone", d.Phone, 16)
+	if strings.TrimSpace(d.Phone) != "" && !isPhone(d.Phone) {
+		c.add("delivery.phone", CodeInvalidFormat, "must be digits with an optional leading +")
+	}
+	c.required("delivery.zip", d.Zip, 20)
+	c.required("delivery.city", d.City, 255)
+	c.required("delivery.address", d.Address, 255)
+	c.optional("delivery.region", d.Region, 255)
+	c.optional("delivery.email", d.Email, 255)
+	if e := strings.TrimSpace(d.Email); e != "" && !isEmail(e) {
+		c.add("delivery.email", CodeInvalidEmail, "must be a valid email address")
+	}
+}
+
+func validatePayment(c *checker, p models.Payment) {
+	c.required("payment.transaction", p.Transaction, 100)
+	c.optional("payment.request_id", p.RequestID, 100)
+	c.required("payment.currency", p.Currency, 0)
+	if strings.TrimSpace(p.Currency) != "" && !isCurrency(p.Currency) {
+		c.add("payment.currency", CodeInvalidFormat, "must be a three-letter ISO 4217 code")
+	}
+	c.required("payment.provider", p.Provider, 50)
+	c.optional("payment.bank", p.Bank, 100)
+	c.nonNegativeInt("payment.amount", p.Amount)
+	c.nonNegative("payment.payment_dt", p.PaymentDT)
+	c.nonNegativeInt("payment.delivery_cost", p.DeliveryCost)
+	c.nonNegativeInt("payment.goods_total", p.GoodsTotal)
+	c.nonNegativeInt("payment.custom_fee", p.CustomFee)
+}
+
+func validateItem(c *checker, prefix string, it models.Item) {
+	c.positive(prefix+".chrt_id", int64(it.ChrtID))
+	c.required(prefix+".track_number", it.TrackNumber, 50)
+	c.nonNegativeInt(prefix+".price", it.Price)
+	c.required(prefix+".rid", it.RID, 100)
+	c.required(prefix+".name", it.Name, 255)
+	if it.Sale < 0 || it.Sale > 100 {
+		c.add(prefix+".sale", CodeOutOfRange, "must be a percentage between 0 and 100")
+	}
+	c.optional(prefix+".size", it.Size, 20)
+	c.nonNegativeInt(prefix+".total_price", it.TotalPrice)
+	c.positive(prefix+".nm_id", int64(it.NmID))
+	c.optional(prefix+".brand", it.Brand, 255)
+	c.nonNegativeInt(prefix+".status", it.Status)
+}
+
+func isEmail(s string) bool {
+	at := strings.IndexByte(s, '@')
+	return at > 0 && at == strings.LastIndexByte(s, '@') && strings.Contains(s[at+1:], ".") && !strings.ContainsAny(s, " \t")
+}
+
+func isPhone(s string) bool {
+	s = strings.TrimPrefix(s, "+")
+	if len(s) < 5 || len(s) > 15 {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isCurrency(s string) bool {
+	if len(s) != 3 {
+		return false
+	}
+	for _, r := range s {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,127 @@
+package validation_test
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/neptship/wbtech-orders/internal/models"
+	"github.com/neptship/wbtech-orders/internal/validation"
+	"github.com/stretchr/testify/require"
+)
+
+func sampleOrder() models.Order {
+	return models.Order{
+		OrderUID:    "b563feb7b2b84b6test",
+		TrackNumber: "WBILMTESTTRACK",
+		Entry:       "WBIL",
+		Delivery: models.Delivery{
+			Name:    "Test Testov",
+			Phone:   "+9720000000",
+			Zip:     "2639809",
+			City:    "Kiryat Mozkin",
+			Address: "Ploshad Mira 15",
+			Region:  "Kraiot",
+			Email:   "test@gmail.com",
+		},
+		Payment: models.Payment{
+			Transaction:  "b563feb7b2b84b6test",
+			Currency:     "USD",
+			Provider:     "wbpay",
+			Amount:       1817,
+			PaymentDT:    1637907727,
+			Bank:         "alpha",
+			DeliveryCost: 1500,
+			GoodsTotal:   317,
+		},
+		Items: []models.Item{{
+			ChrtID:      9934930,
+			TrackNumber: "WBILMTESTTRACK",
+			Price:       453,
+			RID:         "ab4219087a764ae0btest",
+			Name:        "Mascaras",
+			Sale:        30,
+			Size:        "0",
+			TotalPrice:  317,
+			NmID:        2389212,
+			Brand:       "Vivienne Sabo",
+			Status:      202,
+		}},
+		Locale:      "en",
+		CustomerID:  "test",
+		DeliverySvc: "meest",
+		ShardKey:    "9",
+		SmID:        99,
+		DateCreated: "2021-11-26T06:22:19Z",
+		OofShard:    "1",
+	}
+}
+
+func TestValidate_SampleOrderIsValid(t *testing.T) {
+	require.Empty(t, validation.Validate(sampleOrder()))
+	require.NoError(t, validation.Validate(sampleOrder()).Err())
+}
+
+func TestValidate_ReportsEveryViolation(t *testing.T) {
+	o := sampleOrder()
+	o.OrderUID = "bad uid!"
+	o.DateCreated = "yesterday"
+	o.Delivery.Email = "nobody"
+	o.Payment.Currency = "usd"
+	o.Items = append(o.Items, models.Item{ChrtID: 1, TrackNumber: "WBILMTESTTRACK", Price: -1, RID: "r", Name: "n", Sale: 150, NmID: 1})
+
+	errs := validation.Validate(o)
+
+	require.Equal(t, validation.Errors{
+		{Field: "order_uid", Code: validation.CodeInvalidFormat, Message: "must contain only latin letters and digits"},
+		{Field: "date_created", Code: validation.CodeInvalidDate, Message: "must be an RFC 3339 timestamp"},
+		{Field: "delivery.email", Code: validation.CodeInvalidEmail, Message: "must be a valid email address"},
+		{Field: "payment.currency", Code: validation.CodeInvalidFormat, Message: "must be a three-letter ISO 4217 code"},
+		{Field: "items[1].price", Code: validation.CodeNegative, Message: "must not be negative"},
+		{Field: "items[1].sale", Code: validation.CodeOutOfRange, Message: "must be a percentage between 0 and 100"},
+	}, errs)
+	require.Contains(t, errs.Error(), "items[1].price: negative")
+}
+
+func TestValidate_EmptyOrder(t *testing.T) {
+	errs := validation.Validate(models.Order{})
+
+	fields := map[string]string{}
+	for _, fe := range errs {
+		fields[fe.Field] = fe.Code
+	}
+	require.Equal(t, validation.CodeRequired, fields["order_uid"])
+	require.Equal(t, validation.CodeRequired, fields["delivery.name"])
+	require.Equal(t, validation.CodeRequired, fields["payment.transaction"])
+	require.Equal(t, validation.CodeEmpty, fields["items"])
+}
+
+func TestValidate_EnforcesStorageLimits(t *testing.T) {
+	o := sampleOrder()
+	o.Delivery.Phone = " +9720000000"
+	o.Delivery.Zip = strings.Repeat("1", 21)
+	o.Payment.Currency = "USD "
+	o.Payment.Amount = math.MaxInt32 + 1
+	o.Items[0].RID = strings.Repeat("r", 101)
+	o.Items[0].Brand = strings.Repeat("б", 256)
+
+	errs := validation.Validate(o)
+
+	require.Equal(t, validation.Errors{
+		{Field: "delivery.phone", Code: validation.CodeInvalidFormat, Message: "must be digits with an optional leading +"},
+		{Field: "delivery.zip", Code: validation.CodeTooLong, Message: "must be at most 20 characters"},
+		{Field: "payment.currency", Code: validation.CodeInvalidFormat, Message: "must be a three-letter ISO 4217 code"},
+		{Field: "payment.amount", Code: validation.CodeOutOfRange, Message: "must be at most 2147483647"},
+		{Field: "items[0].rid", Code: validation.CodeTooLong, Message: "must be at most 100 characters"},
+		{Field: "items[0].brand", Code: validation.CodeTooLong, Message: "must be at most 255 characters"},
+	}, errs)
+}
+
+func TestValidate_NonPositiveIDIsOutOfRange(t *testing.T) {
+	o := sampleOrder()
+	o.Items[0].NmID = 0
+
+	require.Equal(t, validation.Errors{
+		{Field: "items[0].nm_id", Code: validation.CodeOutOfRange, Message: "must be a positive number"},
+	}, validation.Validate(o))
+}
@@ -0,0 +1,17 @@
+-- +goose Up
+CREATE INDEX IF NOT EXISTS idx_orders_date_created_uid ON orders (date_created DESC, order_uid DESC);
+CREATE INDEX IF NOT EXISTS idx_orders_customer_id ON orders (customer_id, date_created DESC);
+CREATE INDEX IF NOT EXISTS idx_orders_track_number ON orders (track_number);
+CREATE INDEX IF NOT EXISTS idx_orders_delivery_service ON orders (delivery_service, date_created DESC);
+CREATE INDEX IF NOT EXISTS idx_orders_payment_currency ON orders ((payment->>'currency'));
+CREATE INDEX IF NOT EXISTS idx_orders_payment_provider ON orders ((payment->>'provider'));
+CREATE INDEX IF NOT EXISTS idx_orders_items ON orders USING GIN (items jsonb_path_ops);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_orders_items;
+DROP INDEX IF EXISTS idx_orders_payment_provider;
+DROP INDEX IF EXISTS idx_orders_payment_currency;
+DROP INDEX IF EXISTS idx_orders_delivery_service;
+DROP INDEX IF EXISTS idx_orders_track_number;
+DROP INDEX IF EXISTS idx_orders_customer_id;
+DROP INDEX IF EXISTS idx_orders_date_created_uid;
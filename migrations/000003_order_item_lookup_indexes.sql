@@ -0,0 +1,7 @@
+-- +goose Up
+CREATE INDEX IF NOT EXISTS idx_orders_item_rids ON orders USING GIN ((jsonb_path_query_array(items, '$[*].rid')));
+CREATE INDEX IF NOT EXISTS idx_orders_item_chrt_ids ON orders USING GIN ((jsonb_path_query_array(items, '$[*].chrt_id')));
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_orders_item_chrt_ids;
+DROP INDEX IF EXISTS idx_orders_item_rids;
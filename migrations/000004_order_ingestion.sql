@@ -0,0 +1,17 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS order_ingestion (
+    order_uid VARCHAR(100) PRIMARY KEY,
+    status VARCHAR(16) NOT NULL,
+    reason VARCHAR(50),
+    error TEXT,
+    kafka_partition INTEGER,
+    kafka_offset BIGINT,
+    queued_at TIMESTAMPTZ,
+    consumed_at TIMESTAMPTZ,
+    saved_at TIMESTAMPTZ,
+    rejected_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS order_ingestion;
@@ -0,0 +1,15 @@
+-- +goose Up
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS content_hash CHAR(64),
+    ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+ALTER TABLE order_ingestion ADD COLUMN IF NOT EXISTS skipped_at TIMESTAMPTZ;
+
+-- +goose Down
+ALTER TABLE order_ingestion DROP COLUMN IF EXISTS skipped_at;
+
+ALTER TABLE orders
+    DROP COLUMN IF EXISTS updated_at,
+    DROP COLUMN IF EXISTS content_hash,
+    DROP COLUMN IF EXISTS version;
@@ -0,0 +1,55 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS deliveries (
+    order_uid VARCHAR(100) PRIMARY KEY REFERENCES orders (order_uid) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL CHECK (name <> ''),
+    phone VARCHAR(16) NOT NULL CHECK (phone ~ '^\+?[0-9]{5,15}$'),
+    zip VARCHAR(20) NOT NULL CHECK (zip <> ''),
+    city VARCHAR(255) NOT NULL CHECK (city <> ''),
+    address VARCHAR(255) NOT NULL CHECK (address <> ''),
+    region VARCHAR(255) NOT NULL DEFAULT '',
+    email VARCHAR(255) NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS payments (
+    order_uid VARCHAR(100) PRIMARY KEY REFERENCES orders (order_uid) ON DELETE CASCADE,
+    transaction VARCHAR(100) NOT NULL CHECK (transaction <> ''),
+    request_id VARCHAR(100) NOT NULL DEFAULT '',
+    currency CHAR(3) NOT NULL CHECK (currency ~ '^[A-Z]{3}$'),
+    provider VARCHAR(50) NOT NULL CHECK (provider <> ''),
+    amount INTEGER NOT NULL CHECK (amount >= 0),
+    payment_dt BIGINT NOT NULL CHECK (payment_dt >= 0),
+    bank VARCHAR(100) NOT NULL DEFAULT '',
+    delivery_cost INTEGER NOT NULL CHECK (delivery_cost >= 0),
+    goods_total INTEGER NOT NULL CHECK (goods_total >= 0),
+    custom_fee INTEGER NOT NULL CHECK (custom_fee >= 0)
+);
+
+CREATE INDEX IF NOT EXISTS idx_payments_currency ON payments (currency);
+CREATE INDEX IF NOT EXISTS idx_payments_provider ON payments (provider);
+
+CREATE TABLE IF NOT EXISTS order_items (
+    order_uid VARCHAR(100) NOT NULL REFERENCES orders (order_uid) ON DELETE CASCADE,
+    position INTEGER NOT NULL CHECK (position >= 0),
+    chrt_id BIGINT NOT NULL CHECK (chrt_id > 0),
+    track_number VARCHAR(50) NOT NULL CHECK (track_number <> ''),
+    price INTEGER NOT NULL CHECK (price >= 0),
+    rid VARCHAR(100) NOT NULL CHECK (rid <> ''),
+    name VARCHAR(255) NOT NULL CHECK (name <> ''),
+    sale INTEGER NOT NULL CHECK (sale BETWEEN 0 AND 100),
+    size VARCHAR(20) NOT NULL DEFAULT '',
+    total_price INTEGER NOT NULL CHECK (total_price >= 0),
+    nm_id BIGINT NOT NULL CHECK (nm_id > 0),
+    brand VARCHAR(255) NOT NULL DEFAULT '',
+    status INTEGER NOT NULL CHECK (status >= 0),
+    PRIMARY KEY (order_uid, position)
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_items_rid ON order_items (rid);
+CREATE INDEX IF NOT EXISTS idx_order_items_chrt_id ON order_items (chrt_id);
+CREATE INDEX IF NOT EXISTS idx_order_items_nm_id ON order_items (nm_id);
+CREATE INDEX IF NOT EXISTS idx_order_items_brand ON order_items (brand);
+
+-- +goose Down
+DROP TABLE IF EXISTS order_items;
+DROP TABLE IF EXISTS payments;
+DROP TABLE IF EXISTS deliveries;
@@ -0,0 +1,10 @@
+-- +goose Up
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS headers JSONB NOT NULL DEFAULT '{}'::jsonb;
+UPDATE idempotency_keys SET headers = jsonb_build_object('Content-Type', jsonb_build_array(content_type))
+WHERE content_type IS NOT NULL;
+ALTER TABLE idempotency_keys DROP COLUMN IF EXISTS content_type;
+
+-- +goose Down
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS content_type VARCHAR(100);
+UPDATE idempotency_keys SET content_type = headers->'Content-Type'->>0;
+ALTER TABLE idempotency_keys DROP COLUMN IF EXISTS headers;
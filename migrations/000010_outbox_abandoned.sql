@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS abandoned_at TIMESTAMPTZ;
+DROP INDEX IF EXISTS idx_outbox_pending;
+CREATE INDEX IF NOT EXISTS idx_outbox_pending ON outbox (id) WHERE sent_at IS NULL AND abandoned_at IS NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_outbox_pending;
+CREATE INDEX IF NOT EXISTS idx_outbox_pending ON outbox (id) WHERE sent_at IS NULL;
+ALTER TABLE outbox DROP COLUMN IF EXISTS abandoned_at;
@@ -0,0 +1,8 @@
+// Package migrations holds the SQL schema migrations compiled into the
+// binary; see internal/migrate.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
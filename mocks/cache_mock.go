@@ -3,6 +3,9 @@
 package mocks
 
 import (
+	time "time"
+
+	cache "github.com/neptship/wbtech-orders/internal/cache"
 	models "github.com/neptship/wbtech-orders/internal/models"
 	mock "github.com/stretchr/testify/mock"
 )
@@ -76,6 +79,62 @@ func (_c *CacheMock_Get_Call) RunAndReturn(run func(string) (models.Order, bool)
 	return _c
 }
 
+// GetByRID provides a mock function with given fields: rid
+func (_m *CacheMock) GetByRID(rid string) (models.Order, bool) {
+	ret := _m.Called(rid)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetByRID")
+	}
+
+	var r0 models.Order
+	var r1 bool
+	if rf, ok := ret.Get(0).(func(string) (models.Order, bool)); ok {
+		return rf(rid)
+	}
+	if rf, ok := ret.Get(0).(func(string) models.Order); ok {
+		r0 = rf(rid)
+	} else {
+		r0 = ret.Get(0).(models.Order)
+	}
+
+	if rf, ok := ret.Get(1).(func(string) bool); ok {
+		r1 = rf(rid)
+	} else {
+		r1 = ret.Get(1).(bool)
+	}
+
+	return r0, r1
+}
+
+// CacheMock_GetByRID_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetByRID'
+type CacheMock_GetByRID_Call struct {
+	*mock.Call
+}
+
+// GetByRID is a helper method to define mock.On call
+//   - rid string
+func (_e *CacheMock_Expecter) GetByRID(rid interface{}) *CacheMock_GetByRID_Call {
+	return &CacheMock_GetByRID_Call{Call: _e.mock.On("GetByRID", rid)}
+}
+
+func (_c *CacheMock_GetByRID_Call) Run(run func(rid string)) *CacheMock_GetByRID_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string))
+	})
+	return _c
+}
+
+func (_c *CacheMock_GetByRID_Call) Return(_a0 models.Order, _a1 bool) *CacheMock_GetByRID_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *CacheMock_GetByRID_Call) RunAndReturn(run func(string) (models.Order, bool)) *CacheMock_GetByRID_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // Set provides a mock function with given fields: id, order
 func (_m *CacheMock) Set(id string, order models.Order) {
 	_m.Called(id, order)
@@ -110,6 +169,86 @@ func (_c *CacheMock_Set_Call) RunAndReturn(run func(string, models.Order)) *Cach
 	return _c
 }
 
+// SetWithTTL provides a mock function with given fields: id, order, ttl
+func (_m *CacheMock) SetWithTTL(id string, order models.Order, ttl time.Duration) {
+	_m.Called(id, order, ttl)
+}
+
+// CacheMock_SetWithTTL_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'SetWithTTL'
+type CacheMock_SetWithTTL_Call struct {
+	*mock.Call
+}
+
+// SetWithTTL is a helper method to define mock.On call
+//   - id string
+//   - order models.Order
+//   - ttl time.Duration
+func (_e *CacheMock_Expecter) SetWithTTL(id interface{}, order interface{}, ttl interface{}) *CacheMock_SetWithTTL_Call {
+	return &CacheMock_SetWithTTL_Call{Call: _e.mock.On("SetWithTTL", id, order, ttl)}
+}
+
+func (_c *CacheMock_SetWithTTL_Call) Run(run func(id string, order models.Order, ttl time.Duration)) *CacheMock_SetWithTTL_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string), args[1].(models.Order), args[2].(time.Duration))
+	})
+	return _c
+}
+
+func (_c *CacheMock_SetWithTTL_Call) Return() *CacheMock_SetWithTTL_Call {
+	_c.Call.Return()
+	return _c
+}
+
+func (_c *CacheMock_SetWithTTL_Call) RunAndReturn(run func(string, models.Order, time.Duration)) *CacheMock_SetWithTTL_Call {
+	_c.Run(run)
+	return _c
+}
+
+// Stats provides a mock function with no fields
+func (_m *CacheMock) Stats() cache.Stats {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for Stats")
+	}
+
+	var r0 cache.Stats
+	if rf, ok := ret.Get(0).(func() cache.Stats); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(cache.Stats)
+	}
+
+	return r0
+}
+
+// CacheMock_Stats_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Stats'
+type CacheMock_Stats_Call struct {
+	*mock.Call
+}
+
+// Stats is a helper method to define mock.On call
+func (_e *CacheMock_Expecter) Stats() *CacheMock_Stats_Call {
+	return &CacheMock_Stats_Call{Call: _e.mock.On("Stats")}
+}
+
+func (_c *CacheMock_Stats_Call) Run(run func()) *CacheMock_Stats_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run()
+	})
+	return _c
+}
+
+func (_c *CacheMock_Stats_Call) Return(_a0 cache.Stats) *CacheMock_Stats_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *CacheMock_Stats_Call) RunAndReturn(run func() cache.Stats) *CacheMock_Stats_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // NewCacheMock creates a new instance of CacheMock. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func NewCacheMock(t interface {
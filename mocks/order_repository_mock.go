@@ -6,6 +6,7 @@ import (
 	context "context"
 
 	models "github.com/neptship/wbtech-orders/internal/models"
+	repository "github.com/neptship/wbtech-orders/internal/repository"
 	mock "github.com/stretchr/testify/mock"
 )
 
@@ -22,6 +23,181 @@ func (_m *OrderRepositoryMock) EXPECT() *OrderRepositoryMock_Expecter {
 	return &OrderRepositoryMock_Expecter{mock: &_m.Mock}
 }
 
+// FindByChrtID provides a mock function with given fields: ctx, chrtID
+func (_m *OrderRepositoryMock) FindByChrtID(ctx context.Context, chrtID int) ([]models.Order, error) {
+	ret := _m.Called(ctx, chrtID)
+
+	if len(ret) == 0 {
+		panic("no return value specified for FindByChrtID")
+	}
+
+	var r0 []models.Order
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int) ([]models.Order, error)); ok {
+		return rf(ctx, chrtID)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int) []models.Order); ok {
+		r0 = rf(ctx, chrtID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.Order)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int) error); ok {
+		r1 = rf(ctx, chrtID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// OrderRepositoryMock_FindByChrtID_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'FindByChrtID'
+type OrderRepositoryMock_FindByChrtID_Call struct {
+	*mock.Call
+}
+
+// FindByChrtID is a helper method to define mock.On call
+//   - ctx context.Context
+//   - chrtID int
+func (_e *OrderRepositoryMock_Expecter) FindByChrtID(ctx interface{}, chrtID interface{}) *OrderRepositoryMock_FindByChrtID_Call {
+	return &OrderRepositoryMock_FindByChrtID_Call{Call: _e.mock.On("FindByChrtID", ctx, chrtID)}
+}
+
+func (_c *OrderRepositoryMock_FindByChrtID_Call) Run(run func(ctx context.Context, chrtID int)) *OrderRepositoryMock_FindByChrtID_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(int))
+	})
+	return _c
+}
+
+func (_c *OrderRepositoryMock_FindByChrtID_Call) Return(_a0 []models.Order, _a1 error) *OrderRepositoryMock_FindByChrtID_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *OrderRepositoryMock_FindByChrtID_Call) RunAndReturn(run func(context.Context, int) ([]models.Order, error)) *OrderRepositoryMock_FindByChrtID_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// FindByRID provides a mock function with given fields: ctx, rid
+func (_m *OrderRepositoryMock) FindByRID(ctx context.Context, rid string) (models.Order, error) {
+	ret := _m.Called(ctx, rid)
+
+	if len(ret) == 0 {
+		panic("no return value specified for FindByRID")
+	}
+
+	var r0 models.Order
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (models.Order, error)); ok {
+		return rf(ctx, rid)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) models.Order); ok {
+		r0 = rf(ctx, rid)
+	} else {
+		r0 = ret.Get(0).(models.Order)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, rid)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// OrderRepositoryMock_FindByRID_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'FindByRID'
+type OrderRepositoryMock_FindByRID_Call struct {
+	*mock.Call
+}
+
+// FindByRID is a helper method to define mock.On call
+//   - ctx context.Context
+//   - rid string
+func (_e *OrderRepositoryMock_Expecter) FindByRID(ctx interface{}, rid interface{}) *OrderRepositoryMock_FindByRID_Call {
+	return &OrderRepositoryMock_FindByRID_Call{Call: _e.mock.On("FindByRID", ctx, rid)}
+}
+
+func (_c *OrderRepositoryMock_FindByRID_Call) Run(run func(ctx context.Context, rid string)) *OrderRepositoryMock_FindByRID_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string))
+	})
+	return _c
+}
+
+func (_c *OrderRepositoryMock_FindByRID_Call) Return(_a0 models.Order, _a1 error) *OrderRepositoryMock_FindByRID_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *OrderRepositoryMock_FindByRID_Call) RunAndReturn(run func(context.Context, string) (models.Order, error)) *OrderRepositoryMock_FindByRID_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// FindByTrack provides a mock function with given fields: ctx, track
+func (_m *OrderRepositoryMock) FindByTrack(ctx context.Context, track string) ([]models.Order, error) {
+	ret := _m.Called(ctx, track)
+
+	if len(ret) == 0 {
+		panic("no return value specified for FindByTrack")
+	}
+
+	var r0 []models.Order
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) ([]models.Order, error)); ok {
+		return rf(ctx, track)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) []models.Order); ok {
+		r0 = rf(ctx, track)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.Order)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, track)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// OrderRepositoryMock_FindByTrack_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'FindByTrack'
+type OrderRepositoryMock_FindByTrack_Call struct {
+	*mock.Call
+}
+
+// FindByTrack is a helper method to define mock.On call
+//   - ctx context.Context
+//   - track string
+func (_e *OrderRepositoryMock_Expecter) FindByTrack(ctx interface{}, track interface{}) *OrderRepositoryMock_FindByTrack_Call {
+	return &OrderRepositoryMock_FindByTrack_Call{Call: _e.mock.On("FindByTrack", ctx, track)}
+}
+
+func (_c *OrderRepositoryMock_FindByTrack_Call) Run(run func(ctx context.Context, track string)) *OrderRepositoryMock_FindByTrack_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string))
+	})
+	return _c
+}
+
+func (_c *OrderRepositoryMock_FindByTrack_Call) Return(_a0 []models.Order, _a1 error) *OrderRepositoryMock_FindByTrack_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *OrderRepositoryMock_FindByTrack_Call) RunAndReturn(run func(context.Context, string) ([]models.Order, error)) *OrderRepositoryMock_FindByTrack_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // Get provides a mock function with given fields: ctx, id
 func (_m *OrderRepositoryMock) Get(ctx context.Context, id string) (models.Order, error) {
 	ret := _m.Called(ctx, id)
@@ -79,6 +255,63 @@ func (_c *OrderRepositoryMock_Get_Call) RunAndReturn(run func(context.Context, s
 	return _c
 }
 
+// List provides a mock function with given fields: ctx, f
+func (_m *OrderRepositoryMock) List(ctx context.Context, f repository.OrderFilter) (repository.OrderPage, error) {
+	ret := _m.Called(ctx, f)
+
+	if len(ret) == 0 {
+		panic("no return value specified for List")
+	}
+
+	var r0 repository.OrderPage
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, repository.OrderFilter) (repository.OrderPage, error)); ok {
+		return rf(ctx, f)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, repository.OrderFilter) repository.OrderPage); ok {
+		r0 = rf(ctx, f)
+	} else {
+		r0 = ret.Get(0).(repository.OrderPage)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, repository.OrderFilter) error); ok {
+		r1 = rf(ctx, f)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// OrderRepositoryMock_List_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'List'
+type OrderRepositoryMock_List_Call struct {
+	*mock.Call
+}
+
+// List is a helper method to define mock.On call
+//   - ctx context.Context
+//   - f repository.OrderFilter
+func (_e *OrderRepositoryMock_Expecter) List(ctx interface{}, f interface{}) *OrderRepositoryMock_List_Call {
+	return &OrderRepositoryMock_List_Call{Call: _e.mock.On("List", ctx, f)}
+}
+
+func (_c *OrderRepositoryMock_List_Call) Run(run func(ctx context.Context, f repository.OrderFilter)) *OrderRepositoryMock_List_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(repository.OrderFilter))
+	})
+	return _c
+}
+
+func (_c *OrderRepositoryMock_List_Call) Return(_a0 repository.OrderPage, _a1 error) *OrderRepositoryMock_List_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *OrderRepositoryMock_List_Call) RunAndReturn(run func(context.Context, repository.OrderFilter) (repository.OrderPage, error)) *OrderRepositoryMock_List_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // Save provides a mock function with given fields: ctx, o
 func (_m *OrderRepositoryMock) Save(ctx context.Context, o models.Order) error {
 	ret := _m.Called(ctx, o)
@@ -126,6 +359,113 @@ func (_c *OrderRepositoryMock_Save_Call) RunAndReturn(run func(context.Context,
 	return _c
 }
 
+// SaveBatch provides a mock function with given fields: ctx, orders
+func (_m *OrderRepositoryMock) SaveBatch(ctx context.Context, orders []models.Order) ([]error, error) {
+	ret := _m.Called(ctx, orders)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SaveBatch")
+	}
+
+	var r0 []error
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, []models.Order) ([]error, error)); ok {
+		return rf(ctx, orders)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, []models.Order) []error); ok {
+		r0 = rf(ctx, orders)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]error)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, []models.Order) error); ok {
+		r1 = rf(ctx, orders)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// OrderRepositoryMock_SaveBatch_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'SaveBatch'
+type OrderRepositoryMock_SaveBatch_Call struct {
+	*mock.Call
+}
+
+// SaveBatch is a helper method to define mock.On call
+//   - ctx context.Context
+//   - orders []models.Order
+func (_e *OrderRepositoryMock_Expecter) SaveBatch(ctx interface{}, orders interface{}) *OrderRepositoryMock_SaveBatch_Call {
+	return &OrderRepositoryMock_SaveBatch_Call{Call: _e.mock.On("SaveBatch", ctx, orders)}
+}
+
+func (_c *OrderRepositoryMock_SaveBatch_Call) Run(run func(ctx context.Context, orders []models.Order)) *OrderRepositoryMock_SaveBatch_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].([]models.Order))
+	})
+	return _c
+}
+
+func (_c *OrderRepositoryMock_SaveBatch_Call) Return(_a0 []error, _a1 error) *OrderRepositoryMock_SaveBatch_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *OrderRepositoryMock_SaveBatch_Call) RunAndReturn(run func(context.Context, []models.Order) ([]error, error)) *OrderRepositoryMock_SaveBatch_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// StreamRecent provides a mock function with given fields: ctx, limit, fn
+func (_m *OrderRepositoryMock) StreamRecent(ctx context.Context, limit int, fn func(models.Order) error) error {
+	ret := _m.Called(ctx, limit, fn)
+
+	if len(ret) == 0 {
+		panic("no return value specified for StreamRecent")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, int, func(models.Order) error) error); ok {
+		r0 = rf(ctx, limit, fn)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// OrderRepositoryMock_StreamRecent_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'StreamRecent'
+type OrderRepositoryMock_StreamRecent_Call struct {
+	*mock.Call
+}
+
+// StreamRecent is a helper method to define mock.On call
+//   - ctx context.Context
+//   - limit int
+//   - fn func(models.Order) error
+func (_e *OrderRepositoryMock_Expecter) StreamRecent(ctx interface{}, limit interface{}, fn interface{}) *OrderRepositoryMock_StreamRecent_Call {
+	return &OrderRepositoryMock_StreamRecent_Call{Call: _e.mock.On("StreamRecent", ctx, limit, fn)}
+}
+
+func (_c *OrderRepositoryMock_StreamRecent_Call) Run(run func(ctx context.Context, limit int, fn func(models.Order) error)) *OrderRepositoryMock_StreamRecent_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(int), args[2].(func(models.Order) error))
+	})
+	return _c
+}
+
+func (_c *OrderRepositoryMock_StreamRecent_Call) Return(_a0 error) *OrderRepositoryMock_StreamRecent_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *OrderRepositoryMock_StreamRecent_Call) RunAndReturn(run func(context.Context, int, func(models.Order) error) error) *OrderRepositoryMock_StreamRecent_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // NewOrderRepositoryMock creates a new instance of OrderRepositoryMock. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func NewOrderRepositoryMock(t interface {
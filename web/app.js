@@ -0,0 +1,165 @@
+'use strict';
+
+const $ = (id) => document.getElementById(id);
+
+function el(tag, text, className) {
+  const e = document.createElement(tag);
+  if (text !== undefined) e.textContent = String(text);
+  if (className) e.className = className;
+  return e;
+}
+
+// fieldTable renders an object as a two-column field/value table.
+function fieldTable(obj) {
+  const table = el('table');
+  for (const [k, v] of Object.entries(obj)) {
+    const tr = table.insertRow();
+    tr.appendChild(el('th', k));
+    tr.appendChild(el('td', v));
+  }
+  return table;
+}
+
+// rowsTable renders a list of objects with one column per key of the first.
+function rowsTable(rows, columns) {
+  const table = el('table');
+  const head = table.createTHead().insertRow();
+  columns = columns || Object.keys(rows[0] || {});
+  for (const c of columns) head.appendChild(el('th', c));
+  const body = table.createTBody();
+  for (const r of rows) {
+    const tr = body.insertRow();
+    for (const c of columns) tr.appendChild(el('td', r[c] ?? ''));
+  }
+  return table;
+}
+
+function setStatus(node, text, className) {
+  node.textContent = text;
+  node.className = 'status ' + (className || '');
+}
+
+// readError extracts a message from an API error response, normally an
+// RFC 7807 problem.
+async function readError(res) {
+  const text = await res.text();
+  try {
+    const body = JSON.parse(text);
+    return body.detail || body.title || text;
+  } catch {
+    return text.trim() || res.statusText;
+  }
+}
+
+function renderOrder(o) {
+  const root = $('order');
+  root.replaceChildren();
+  const { delivery, payment, items, ...order } = o;
+  root.append(el('h2', 'Order ' + o.order_uid), fieldTable(order));
+  root.append(el('h3', 'Delivery'), fieldTable(delivery || {}));
+  const p = { ...(payment || {}) };
+  if (p.payment_dt) p.payment_dt = new Date(p.payment_dt * 1000).toISOString() + ' (' + payment.payment_dt + ')';
+  root.append(el('h3', 'Payment'), fieldTable(p));
+  root.append(el('h3', 'Items (' + (items || []).length + ')'));
+  if (items && items.length) {
+    root.append(rowsTable(items, ['chrt_id', 'nm_id', 'name', 'brand', 'size', 'price', 'sale', 'total_price', 'rid', 'track_number', 'status']));
+  }
+}
+
+$('lookup').addEventListener('submit', async (ev) => {
+  ev.preventDefault();
+  const id = $('orderId').value.trim();
+  const status = $('lookupStatus');
+  $('order').replaceChildren();
+  if (!id) return;
+  setStatus(status, 'Loading…');
+  try {
+    const res = await fetch('/order/' + encodeURIComponent(id));
+    if (!res.ok) {
+      setStatus(status, res.status === 404 ? 'Order not found' : 'Error: ' + (await readError(res)), 'error');
+      return;
+    }
+    setStatus(status, '');
+    renderOrder(await res.json());
+  } catch (e) {
+    setStatus(status, 'Request failed: ' + e.message, 'error');
+  }
+});
+
+function renderIssues(title, issues, className) {
+  if (!issues || !issues.length) return;
+  const root = $('addErrors');
+  root.append(el('h3', title, className), rowsTable(issues, ['field', 'code', 'message']));
+}
+
+$('add').addEventListener('submit', async (ev) => {
+  ev.preventDefault();
+  const status = $('addStatus');
+  $('addErrors').replaceChildren();
+  const payload = $('payload').value;
+  try {
+    JSON.parse(payload);
+  } catch (e) {
+    setStatus(status, 'Invalid JSON: ' + e.message, 'error');
+    return;
+  }
+  setStatus(status, 'Submitting…');
+  try {
+    const res = await fetch('/order_add' + ($('wait').checked ? '?wait=5s' : ''), {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: payload,
+    });
+    const isJSON = (res.headers.get('Content-Type') || '').includes('json');
+    const body = isJSON ? await res.json() : null;
+    if (res.status === 201) {
+      setStatus(status, 'Order stored', 'ok');
+      renderOrder(body);
+      return;
+    }
+    if (res.ok) {
+      setStatus(status, 'Order accepted (' + ((body && body.status) || res.status) + ')', 'ok');
+      renderIssues('Warnings', body && body.warnings, 'warning');
+      return;
+    }
+    if (body && body.code === 'order_rejected') {
+      setStatus(status, 'Order rejected by consumer (' + body.reason + '): ' + body.detail, 'error');
+      return;
+    }
+    if (body && body.errors) {
+      setStatus(status, 'Order rejected: ' + body.errors.length + ' validation error(s)', 'error');
+      renderIssues('Errors', body.errors, 'error');
+      renderIssues('Warnings', body.warnings, 'warning');
+      return;
+    }
+    const msg = body ? (body.detail || body.title || JSON.stringify(body)) : await readError(res);
+    const ref = body && body.request_id ? ' [request ' + body.request_id + ']' : '';
+    setStatus(status, 'Error ' + res.status + ': ' + msg + ref, 'error');
+  } catch (e) {
+    setStatus(status, 'Request failed: ' + e.message, 'error');
+  }
+});
+
+const sample = {
+  order_uid: 'b563feb7b2b84b6test',
+  track_number: 'WBILMTESTTRACK',
+  entry: 'WBIL',
+  delivery: {
+    name: 'Test Testov', phone: '+9720000000', zip: '2639809', city: 'Kiryat Mozkin',
+    address: 'Ploshad Mira 15', region: 'Kraiot', email: 'test@gmail.com',
+  },
+  payment: {
+    transaction: 'b563feb7b2b84b6test', request_id: '', currency: 'USD', provider: 'wbpay',
+    amount: 1817, payment_dt: 1637907727, bank: 'alpha', delivery_cost: 1500, goods_total: 317, custom_fee: 0,
+  },
+  items: [{
+    chrt_id: 9934930, track_number: 'WBILMTESTTRACK', price: 453, rid: 'ab4219087a764ae0btest',
+    name: 'Mascaras', sale: 30, size: '0', total_price: 317, nm_id: 2389212, brand: 'Vivienne Sabo', status: 202,
+  }],
+  locale: 'en', internal_signature: '', customer_id: 'test', delivery_service: 'meest',
+  shardkey: '9', sm_id: 99, date_created: '2021-11-26T06:22:19Z', oof_shard: '1',
+};
+
+$('sample').addEventListener('click', () => {
+  $('payload').value = JSON.stringify(sample, null, 2);
+});
@@ -0,0 +1,15 @@
+// Package web holds the static order lookup UI compiled into the binary.
+package web
+
+import (
+	"embed"
+	"net/http"
+)
+
+//go:embed index.html app.js style.css
+var FS embed.FS
+
+// Handler serves the UI, with index.html at /.
+func Handler() http.Handler {
+	return http.FileServer(http.FS(FS))
+}
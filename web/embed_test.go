@@ -0,0 +1,21 @@
+package web_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/neptship/wbtech-orders/web"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler_ServesIndex(t *testing.T) {
+	rec := httptest.NewRecorder()
+	web.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), "<title>Order Lookup</title>")
+
+	rec = httptest.NewRecorder()
+	web.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/app.js", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+}